@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/Eagerod/wp/pkg/wp"
+	"github.com/spf13/cobra"
+)
+
+var bezelCommand = &cobra.Command{
+	Use:   "bezel monitor_dimensions destination_dir image_path [image_path...]",
+	Short: "Split a panorama across side by side monitors",
+	Long:  "Cut one slice per monitor out of an image for monitors that sit side by side, skipping the part of the image hidden behind the bezels between them. Monitors are listed from left to right, like 2560x1440,2560x1440",
+	Args:  cobra.MinimumNArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		monitorDimensions := args[0]
+		destinationDir := args[1]
+		imagePaths := args[2:]
+
+		if err := wp.ValidateBezel(bezelFlag, bezelMillimetresFlag, dpiFlag); err != nil {
+			return err
+		}
+
+		gap := bezelFlag
+		if bezelMillimetresFlag > 0 {
+			gap = wp.BezelPixels(bezelMillimetresFlag, dpiFlag)
+		}
+
+		if _, err := wp.ParseBezelLayout(monitorDimensions, gap); err != nil {
+			return err
+		}
+
+		return processImages(imagePaths, func(is *wp.ImageSource, opts wp.Options) error {
+			return wp.BezelFromImage(monitorDimensions, gap, destinationDir, is, opts)
+		})
+	},
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/Eagerod/wp/pkg/wp"
+)
+
+type imageProcessor func(is *wp.ImageSource, opts wp.Options) error
+
+// Parse the list of dimensions given to a command, adding a set of dimensions
+//   for each of the scale factors.
+func parseDimensionsArg(str string) ([]string, error) {
+	dimensions, err := wp.ParseDimensionsList(str)
+	if err != nil {
+		return nil, err
+	}
+
+	factors, err := wp.ParseScaleFactors(scaleFactorsFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	return wp.ScaledDimensions(dimensions, factors), nil
+}
+
+// Build a processor that runs the provided function once for each of the
+//   dimensions, so that each image is only prepared once.
+// Errors from every set of dimensions are combined, so images too small for
+//   some of them are still soft errors.
+func forEachDimensions(dimensions []string, process func(dimensions string, is *wp.ImageSource, opts wp.Options) error) imageProcessor {
+	return func(is *wp.ImageSource, opts wp.Options) error {
+		var errs []error
+		for _, d := range dimensions {
+			errs = append(errs, process(d, is, opts))
+		}
+
+		if err := wp.MultiErrorFromErrors(errs); err.Exists() {
+			return err
+		}
+
+		return nil
+	}
+}
+
+// Prepare every image, and run the processor against each of them, handling
+//   up to jobsFlag images at once.
+// Paths reported while processing an image are written to stderr in the same
+//   order that images were provided, no matter which finishes first.
+func processImages(imagePaths []string, process imageProcessor) error {
+	renderer, err := wp.RendererForName(rendererName)
+	if err != nil {
+		return err
+	}
+
+	if err := wp.ValidateFilter(filterFlag); err != nil {
+		return err
+	}
+
+	if sharpenFlag < 0 {
+		return errors.New("Sharpen amount must not be negative")
+	}
+
+	if stepsFlag < 0 {
+		return errors.New("Steps must not be negative")
+	}
+
+	if err := wp.ValidateFormat(formatFlag); err != nil {
+		return err
+	}
+
+	if err := wp.ValidateRendererFormat(renderer, formatFlag); err != nil {
+		return err
+	}
+
+	if err := wp.ValidateQuality(qualityFlag, compressionFlag); err != nil {
+		return err
+	}
+
+	if duplicateToleranceFlag < 0 {
+		return errors.New("Duplicate tolerance must not be negative")
+	}
+
+	if err := wp.ValidateMaxUpscale(maxUpscaleFlag); err != nil {
+		return err
+	}
+
+	if err := wp.ValidateFit(fitFlag, fillFlag); err != nil {
+		return err
+	}
+
+	if err := wp.ValidateTransform(rotateFlag, flipFlag); err != nil {
+		return err
+	}
+
+	if retriesFlag < 0 {
+		return errors.New("Retries must not be negative")
+	}
+
+	if maxAgeFlag < 0 {
+		return errors.New("Maximum age must not be negative")
+	}
+
+	downloadOpts := wp.DownloadOptions{
+		ConnectTimeout: connectTimeoutFlag,
+		ReadTimeout:    readTimeoutFlag,
+		Retries:        retriesFlag,
+		MaxSize:        maxDownloadFlag,
+		Revalidate:     revalidateFlag,
+		MaxAge:         maxAgeFlag,
+		Offline:        offlineFlag,
+	}
+
+	zooms, err := wp.ParseZoomLevels(zoomFlag)
+	if err != nil {
+		return err
+	}
+
+	opts := wp.Options{
+		Renderer:    renderer,
+		Filter:      filterFlag,
+		Sharpen:     sharpenFlag,
+		Format:      formatFlag,
+		Quality:     qualityFlag,
+		Compression: compressionFlag,
+		Auto:        autoFlag,
+		Steps:       stepsFlag,
+		Zoom:        zooms,
+		Overlap:     overlapFlag,
+		Fit:         fitFlag,
+		Fill:        fillFlag,
+		MaxUpscale:  maxUpscaleFlag,
+		Rotate:      rotateFlag,
+		Flip:        flipFlag,
+
+		DuplicateTolerance: duplicateToleranceFlag,
+	}
+
+	// Images are already being processed in parallel, so split the CPUs
+	//   between them, rather than letting each one use all of them.
+	if jobsFlag > 1 {
+		wp.SetNativeJobs(runtime.NumCPU() / jobsFlag)
+	}
+
+	logs := make([]bytes.Buffer, len(imagePaths))
+	finished := make([]bool, len(imagePaths))
+	prepareErrs := make([]error, len(imagePaths))
+	errs := make([]error, len(imagePaths))
+
+	var mutex sync.Mutex
+	nextLog := 0
+
+	wp.RunJobs(jobsFlag, len(imagePaths), func(i int) {
+		// Images that were prepared with a soft error, like cached ones that
+		//   couldn't be revalidated, are still processed.
+		is, err := wp.PrepareImageFromSource(imagePaths[i], cacheDir, downloadOpts)
+		if err != nil && softErrorRegexp.FindStringSubmatch(err.Error()) == nil {
+			prepareErrs[i] = err
+		} else {
+			imageOpts := opts
+			imageOpts.Log = &logs[i]
+			errs[i] = process(is, imageOpts)
+			if err != nil {
+				errs[i] = wp.MultiErrorFromErrors([]error{err, errs[i]})
+			}
+		}
+
+		if is != nil {
+			wp.CleanupImageSource(is)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		finished[i] = true
+		for nextLog < len(finished) && finished[nextLog] {
+			os.Stderr.Write(logs[nextLog].Bytes())
+			nextLog++
+		}
+	})
+
+	// Failing to get hold of an image at all is never a soft error.
+	for _, err := range prepareErrs {
+		if err != nil {
+			return err
+		}
+	}
+
+	// If the only thing the error is is a series of soft errors, don't
+	//   exit with failure.
+	multiError := wp.MultiErrorFromErrors(errs)
+	if multiError.Exists() {
+		if softErrorRegexp.FindStringSubmatch(multiError.Error()) == nil {
+			return multiError
+		}
+
+		fmt.Fprintln(os.Stderr, multiError.Error())
+	}
+
+	return nil
+}
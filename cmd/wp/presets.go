@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Eagerod/wp/pkg/wp"
+	"github.com/spf13/cobra"
+)
+
+var presetsCommand = &cobra.Command{
+	Use:   "presets",
+	Short: "List the named dimensions that can be used in place of WxH",
+	Long:  "List the named dimensions that can be used in place of WxH, including any added in the presets section of the user's config file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		presets, err := wp.Presets()
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(presets))
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Printf("%s %s\n", name, presets[name])
+		}
+
+		return nil
+	},
+}
@@ -3,14 +3,45 @@ package cmd
 import (
 	"os"
 	"regexp"
+	"runtime"
+	"time"
 
+	"github.com/Eagerod/wp/pkg/wp"
 	"github.com/spf13/cobra"
 )
 
-var softErrorRegexp *regexp.Regexp = regexp.MustCompile(`^(?:Image .*? is not (?:tall|wide) enough to produce quality output\n?)+$`)
+var softErrorRegexp *regexp.Regexp = regexp.MustCompile(`^(?:Image .*? (?:is not (?:tall|wide) enough to produce quality (?:unscaled )?\S+ output(?: at \S+ zoom)?|was upscaled \S+ to produce .*|would produce duplicate slices in \S+, skipped .*|couldn't be revalidated, so its cached copy was used .*)\n?)+$`)
 
 var scaledFlag bool
+var autoFlag bool
+var stepsFlag int
+var overlapFlag float64
+var fitFlag string
+var fillFlag string
+var maxUpscaleFlag float64
+var duplicateToleranceFlag int
+var scaleFactorsFlag string
+var rotateFlag int
+var bezelFlag int
+var bezelMillimetresFlag float64
+var dpiFlag float64
+var flipFlag string
 var cacheDir string
+var connectTimeoutFlag time.Duration
+var readTimeoutFlag time.Duration
+var retriesFlag int
+var maxDownloadFlag int64
+var revalidateFlag bool
+var maxAgeFlag time.Duration
+var offlineFlag bool
+var rendererName string
+var jobsFlag int
+var filterFlag string
+var sharpenFlag float64
+var formatFlag string
+var qualityFlag int
+var compressionFlag int
+var zoomFlag string
 
 var baseCommand = &cobra.Command{
 	Use:   os.Args[0],
@@ -18,15 +49,79 @@ var baseCommand = &cobra.Command{
 	Long:  "Manipulate images for use as desktop wallpapers",
 }
 
+// Add the flags for commands that produce slices for single displays; how
+//   scaled slices fit their source, and the scale factors of the displays.
+func addDisplayFlags(command *cobra.Command) {
+	command.Flags().StringVarP(&scaleFactorsFlag, "scale-factors", "", "", "Comma separated display scale factors to produce slices for, like 1,2; slices are bucketed like 1440x900@2x")
+	command.Flags().StringVarP(&fitFlag, "fit", "", wp.FitCover, "How scaled slices fit the image; cover crops the image, contain shows all of it")
+	command.Flags().StringVarP(&fillFlag, "fill", "", wp.DefaultFill, "Fill for the rest of contained slices; a colour like black or #223344, edge, or blur")
+}
+
+// Add the flags shared by every command that produces slices; how images
+//   are fetched, and how slices are rendered and written.
+func addSliceFlags(command *cobra.Command) {
+	command.Flags().StringVarP(&cacheDir, "cache", "", "", "Source image cache; used to prevent repeated downloads")
+	command.Flags().DurationVarP(&connectTimeoutFlag, "connect-timeout", "", wp.DefaultConnectTimeout, "Longest to wait to connect when downloading an image")
+	command.Flags().DurationVarP(&readTimeoutFlag, "read-timeout", "", wp.DefaultReadTimeout, "Longest to wait for more of an image being downloaded")
+	command.Flags().IntVarP(&retriesFlag, "retries", "", 2, "Number of times to retry downloads that time out or fail with a server error")
+	command.Flags().Int64VarP(&maxDownloadFlag, "max-download", "", wp.DefaultMaxDownload, "Largest image, in bytes, that will be downloaded")
+	command.Flags().BoolVarP(&revalidateFlag, "revalidate", "", false, "Download cached images again if they've changed since they were cached")
+	command.Flags().DurationVarP(&maxAgeFlag, "max-age", "", 0, "Download cached images again if they've changed, once they were cached longer ago than this; 0 never does")
+	command.Flags().BoolVarP(&offlineFlag, "offline", "", false, "Only use images that are already cached, rather than downloading any")
+	command.Flags().IntVarP(&jobsFlag, "jobs", "j", runtime.NumCPU(), "Number of images to process at once")
+	command.Flags().StringVarP(&rendererName, "renderer", "", wp.RendererAuto, "Renderer used to produce slices; one of auto, convert, magick, gm, vips, native")
+	command.Flags().StringVarP(&formatFlag, "format", "", "", "Format to write slices in; one of png, jpeg, webp, avif. Defaults to the source's format")
+	command.Flags().IntVarP(&qualityFlag, "quality", "", 0, "Quality of jpeg, webp, and avif slices, from 1 to 100; 0 uses the renderer's default")
+	command.Flags().IntVarP(&compressionFlag, "compression", "", 0, "Compression level of png slices, from 1 to 9; 0 uses the renderer's default")
+	command.Flags().IntVarP(&rotateFlag, "rotate", "", 0, "Degrees to rotate each image clockwise before slicing it; one of 0, 90, 180, 270")
+	command.Flags().StringVarP(&flipFlag, "flip", "", "", "Direction to flip each image in before slicing it, after rotating it; h or v")
+}
+
+// Add the flags for commands that scale images to produce slices; how
+//   they're resampled, and how far they're zoomed in.
+func addScalingFlags(command *cobra.Command) {
+	command.Flags().StringVarP(&filterFlag, "filter", "", wp.FilterBox, "Filter used to scale slices; one of box, triangle, catmull-rom, mitchell, lanczos")
+	command.Flags().Float64VarP(&sharpenFlag, "sharpen", "", 0, "Amount to sharpen scaled slices by; 0 disables sharpening")
+	command.Flags().StringVarP(&zoomFlag, "zoom", "", "", "Comma separated zoom levels to take scaled slices at, like 1.0,1.5,2.0; 1 just covers the slice")
+}
+
 func Execute() {
+	baseCommand.AddCommand(bezelCommand)
 	baseCommand.AddCommand(extractCommand)
 	baseCommand.AddCommand(pickCommand)
+	baseCommand.AddCommand(presetsCommand)
+	baseCommand.AddCommand(spanCommand)
+	baseCommand.AddCommand(tileCommand)
 	baseCommand.AddCommand(versionCommand)
 
-	extractCommand.Flags().StringVarP(&cacheDir, "cache", "", "", "Source image cache; used to prevent repeated downloads")
+	extractCommand.Flags().BoolVarP(&autoFlag, "auto", "", false, "Also produce slices placed over the most interesting part of each image")
+	extractCommand.Flags().IntVarP(&stepsFlag, "steps", "", 0, "Number of evenly spaced scaled slices to take along the long axis of each image; 0 uses west/center/east or north/center/south")
+	extractCommand.Flags().Float64VarP(&maxUpscaleFlag, "max-upscale", "", 1, "How much scaled slices may enlarge images smaller than the slices, like 1.1 for 10%; unscaled slices of those images are skipped")
+	extractCommand.Flags().IntVarP(&duplicateToleranceFlag, "duplicate-tolerance", "", 1, "Most pixels scaled slices can move from the center of an image before more than the centered slice is taken")
+	addDisplayFlags(extractCommand)
+	addScalingFlags(extractCommand)
+	addSliceFlags(extractCommand)
 
 	pickCommand.Flags().BoolVarP(&scaledFlag, "scaled", "", false, "Scale the image to the desired dimensions, rather than maintaining scale")
-	pickCommand.Flags().StringVarP(&cacheDir, "cache", "", "", "Source image cache; used to prevent repeated downloads")
+	addDisplayFlags(pickCommand)
+	addScalingFlags(pickCommand)
+	addSliceFlags(pickCommand)
+
+	spanCommand.Flags().BoolVarP(&scaledFlag, "scaled", "", false, "Scale the image to cover the whole layout, rather than maintaining scale")
+	addScalingFlags(spanCommand)
+	addSliceFlags(spanCommand)
+
+	bezelCommand.Flags().IntVarP(&bezelFlag, "bezel", "", 0, "Pixels of the image hidden behind the bezels between each pair of monitors")
+	bezelCommand.Flags().Float64VarP(&bezelMillimetresFlag, "bezel-mm", "", 0, "Width of the bezels between each pair of monitors in millimetres; needs --dpi")
+	bezelCommand.Flags().Float64VarP(&dpiFlag, "dpi", "", 0, "Pixel density of the monitors, used to convert --bezel-mm to pixels")
+	bezelCommand.Flags().Float64VarP(&maxUpscaleFlag, "max-upscale", "", 1, "How much slices may enlarge images smaller than the monitors, like 1.1 for 10%")
+	bezelCommand.Flags().IntVarP(&duplicateToleranceFlag, "duplicate-tolerance", "", 1, "Most pixels slices can move from the center of an image before more than the centered slices are taken")
+	addScalingFlags(bezelCommand)
+	addSliceFlags(bezelCommand)
+
+	// Tiles are always cut at the image's own scale, so can't be scaled.
+	tileCommand.Flags().Float64VarP(&overlapFlag, "overlap", "", 0, "Smallest percentage of each tile that overlaps with its neighbours")
+	addSliceFlags(tileCommand)
 
 	if err := baseCommand.Execute(); err != nil {
 		os.Exit(1)
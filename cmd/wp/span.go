@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/Eagerod/wp/pkg/wp"
+	"github.com/spf13/cobra"
+)
+
+var spanCommand = &cobra.Command{
+	Use:   "span layout destination_dir gravity [--scaled] image_path [image_path...]",
+	Short: "Span an image across many monitors",
+	Long:  "Cut one slice per monitor out of an image, so that it continues across every monitor in the layout. Layouts list each monitor's dimensions and offset, like 2560x1440+0+0,1080x1920+2560-240",
+	Args:  cobra.MinimumNArgs(4),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		layout := args[0]
+		destinationDir := args[1]
+		gravity := args[2]
+		imagePaths := args[3:]
+
+		if _, err := wp.ParseLayoutString(layout); err != nil {
+			return err
+		}
+
+		return processImages(imagePaths, func(is *wp.ImageSource, opts wp.Options) error {
+			return wp.SpanFromImage(layout, destinationDir, is, scaledFlag, gravity, opts)
+		})
+	},
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/Eagerod/wp/pkg/wp"
+	"github.com/spf13/cobra"
+)
+
+var tileCommand = &cobra.Command{
+	Use:   "tile desired_dimensions destination_dir image_path [image_path...]",
+	Short: "Tile images",
+	Long:  "Cut images into a grid of slices at their own scale, covering every part of them",
+	Args:  cobra.MinimumNArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		desiredDimensions := args[0]
+		destinationDir := args[1]
+		imagePaths := args[2:]
+
+		if err := wp.ValidateOverlap(overlapFlag); err != nil {
+			return err
+		}
+
+		return processImages(imagePaths, func(is *wp.ImageSource, opts wp.Options) error {
+			return wp.TileFromImage(desiredDimensions, destinationDir, is, opts)
+		})
+	},
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 )
 
@@ -36,13 +43,147 @@ func TestExtractOneImage(t *testing.T) {
 	assert.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
+	cmd := exec.Command(binPath, "extract", "64x64", tempDir, sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	filenameSuffixes := []string{
+		"scaled_center",
+		"north",
+		"northeast",
+		"east",
+		"southeast",
+		"south",
+		"southwest",
+		"west",
+		"northwest",
+		"center",
+	}
+
+	expectedOutput := ""
+	for _, str := range filenameSuffixes {
+		expectedOutput += path.Join(tempDir, "64x64", "square_"+str) + ".jpg\n"
+	}
+
+	assert.Equal(t, expectedOutput, string(output))
+}
+
+func TestExtractOneImageDuplicates(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "square.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
 	cmd := exec.Command(binPath, "extract", "128x128", tempDir, sourceImage)
 
 	output, err := cmd.CombinedOutput()
 	assert.NoError(t, err)
 
+	// Every unscaled slice of an image the same size as the slices is the
+	//   same as the scaled one.
+	expectedOutput := path.Join(tempDir, "128x128", "square_scaled_center.jpg") + "\n"
+	expectedOutput += "Image (square.jpg) would produce duplicate slices in 128x128, skipped square_north.jpg, square_northeast.jpg, square_east.jpg, square_southeast.jpg, square_south.jpg, square_southwest.jpg, square_west.jpg, square_northwest.jpg, square_center.jpg\n"
+
+	assert.Equal(t, expectedOutput, string(output))
+}
+
+func TestExtractOneImageManyDimensions(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "square.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "extract", "64x64,1024x1024,32x32", tempDir, sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	expectedOutput := ""
+	for _, dimensions := range []string{"64x64", "32x32"} {
+		for _, str := range []string{"scaled_center", "north", "northeast", "east", "southeast", "south", "southwest", "west", "northwest", "center"} {
+			expectedOutput += path.Join(tempDir, dimensions, "square_"+str) + ".jpg\n"
+		}
+	}
+	expectedOutput += "Image (square.jpg) is not wide enough to produce quality 1024x1024 output\n"
+
+	assert.Equal(t, expectedOutput, string(output))
+
+	_, err = os.Stat(path.Join(tempDir, "1024x1024"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPickImageScaleFactors(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "pick", "32x16", tempDir, "center", "--scaled", "--scale-factors", "1,2", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	expectedOutput := ""
+	for i, bucket := range []string{"32x16", "32x16@2x"} {
+		size := image.Pt(32, 16).Mul(i + 1)
+		outputImage := path.Join(tempDir, bucket, "wide_scaled_center.jpg")
+		expectedOutput += outputImage + "\n"
+
+		f, err := os.Open(outputImage)
+		assert.NoError(t, err)
+		config, _, err := image.DecodeConfig(f)
+		f.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, size, image.Pt(config.Width, config.Height))
+	}
+
+	assert.Equal(t, expectedOutput, string(output))
+}
+
+func TestExtractOneImageScaleFactorTooLarge(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "square.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "extract", "100x100", tempDir, "--scale-factors", "1,2", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), path.Join(tempDir, "100x100", "square_scaled_center.jpg")+"\n")
+	assert.Contains(t, string(output), "Image (square.jpg) is not wide enough to produce quality 100x100@2x output\n")
+
+	_, err = os.Stat(path.Join(tempDir, "100x100@2x"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExtractOneImageAuto(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "extract", "64x64", tempDir, "--auto", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
 	filenameSuffixes := []string{
+		"scaled_west",
 		"scaled_center",
+		"scaled_east",
+		"scaled_auto",
 		"north",
 		"northeast",
 		"east",
@@ -52,11 +193,16 @@ func TestExtractOneImage(t *testing.T) {
 		"west",
 		"northwest",
 		"center",
+		"auto",
 	}
 
 	expectedOutput := ""
 	for _, str := range filenameSuffixes {
-		expectedOutput += path.Join(tempDir, "128x128", "square_"+str) + ".jpg\n"
+		outputImage := path.Join(tempDir, "64x64", "wide_"+str) + ".jpg"
+		expectedOutput += outputImage + "\n"
+
+		_, err = os.Stat(outputImage)
+		assert.NoError(t, err)
 	}
 
 	assert.Equal(t, expectedOutput, string(output))
@@ -88,7 +234,7 @@ func TestExtractMultipleImages(t *testing.T) {
 	assert.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
-	cmd := exec.Command(binPath, "extract", "128x128", tempDir, sourceImage1, sourceImage2)
+	cmd := exec.Command(binPath, "extract", "64x64", tempDir, sourceImage1, sourceImage2)
 
 	output, err := cmd.CombinedOutput()
 	assert.NoError(t, err)
@@ -119,11 +265,37 @@ func TestExtractMultipleImages(t *testing.T) {
 
 	expectedOutput := ""
 	for _, str := range append(tallFilenameSuffixes, bothFilenameSuffixes...) {
-		expectedOutput += path.Join(tempDir, "128x128", "tall_"+str) + ".jpg\n"
+		expectedOutput += path.Join(tempDir, "64x64", "tall_"+str) + ".jpg\n"
 	}
 
 	for _, str := range append(wideFilenameSuffixes, bothFilenameSuffixes...) {
-		expectedOutput += path.Join(tempDir, "128x128", "wide_"+str) + ".jpg\n"
+		expectedOutput += path.Join(tempDir, "64x64", "wide_"+str) + ".jpg\n"
+	}
+
+	assert.Equal(t, expectedOutput, string(output))
+}
+
+func TestPickMultipleImagesInParallel(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImages := []string{}
+	for _, name := range []string{"tall", "wide", "square"} {
+		sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", name+".jpg"))
+		sourceImages = append(sourceImages, sourceImage)
+	}
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	args := append([]string{"pick", "128x128", tempDir, "center", "--jobs", "3"}, sourceImages...)
+	cmd := exec.Command(binPath, args...)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	expectedOutput := ""
+	for _, name := range []string{"tall", "wide", "square"} {
+		expectedOutput += path.Join(tempDir, "128x128", name+"_center.jpg") + "\n"
 	}
 
 	assert.Equal(t, expectedOutput, string(output))
@@ -153,7 +325,7 @@ func TestExtractFromThisDirectory(t *testing.T) {
 	assert.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
-	cmd := exec.Command(binPath, "extract", "128x128", tempDir, sourceImage)
+	cmd := exec.Command(binPath, "extract", "64x64", tempDir, sourceImage)
 
 	output, err := cmd.CombinedOutput()
 	assert.NoError(t, err)
@@ -173,7 +345,7 @@ func TestExtractFromThisDirectory(t *testing.T) {
 
 	expectedOutput := ""
 	for _, str := range filenameSuffixes {
-		expectedOutput += path.Join(tempDir, "128x128", "square_"+str) + ".jpg\n"
+		expectedOutput += path.Join(tempDir, "64x64", "square_"+str) + ".jpg\n"
 	}
 
 	assert.Equal(t, expectedOutput, string(output))
@@ -312,3 +484,458 @@ func TestPickFromThisDirectory(t *testing.T) {
 
 	os.Remove(sourceImage)
 }
+
+func TestPickImageNativeRenderer(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "pick", "64x64", tempDir, "east", "--scaled", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	outputImage := path.Join(tempDir, "64x64", "wide_scaled_east.jpg")
+	assert.Equal(t, outputImage+"\n", string(output))
+
+	_, err = os.Stat(outputImage)
+	assert.NoError(t, err)
+}
+
+func TestPickImageFormat(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "square.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "pick", "64x64", tempDir, "center", "--scaled", "--format", "png", "--compression", "9", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	outputImage := path.Join(tempDir, "64x64", "square_scaled_center.png")
+	assert.Equal(t, outputImage+"\n", string(output))
+
+	_, err = os.Stat(outputImage)
+	assert.NoError(t, err)
+}
+
+func TestPickImageRotated(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "pick", "64x128", tempDir, "center", "--rotate", "90", "--flip", "h", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	outputImage := path.Join(tempDir, "64x128", "wide_rot90_fliph_center.jpg")
+	assert.Equal(t, outputImage+"\n", string(output))
+
+	f, err := os.Open(outputImage)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(64, 128), image.Pt(config.Width, config.Height))
+}
+
+func TestPickImageBadRotation(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "pick", "64x64", tempDir, "center", "--rotate", "45", "image.jpg")
+
+	output, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "Provided rotation (45) must be one of 0, 90, 180, or 270")
+}
+
+func TestPickImageOffline(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "pick", "64x64", tempDir, "center", "--offline", "--cache", tempDir, "http://example.invalid/image.jpg")
+
+	output, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "Image (http://example.invalid/image.jpg) isn't cached, so can't be used offline")
+}
+
+func TestPickImageRevalidateUnavailable(t *testing.T) {
+	cwd, _ := os.Getwd()
+	contents, err := ioutil.ReadFile(path.Join(cwd, "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	// Read by the server's goroutines, so only touched atomically.
+	available := int32(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&available) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(contents)
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	sourceUrl := server.URL + "/square.jpg"
+	cmd := exec.Command(binPath, "pick", "64x64", tempDir, "center", "--renderer", "native", "--cache", tempDir, sourceUrl)
+
+	_, err = cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	// The cached copy is still used, with a warning, when the host is down.
+	atomic.StoreInt32(&available, 0)
+	cmd = exec.Command(binPath, "pick", "64x64", tempDir, "center", "--renderer", "native", "--cache", tempDir, "--revalidate", "--retries", "0", sourceUrl)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), path.Join(tempDir, "64x64", "square_center.jpg")+"\n")
+	assert.Contains(t, string(output), "Image ("+sourceUrl+") couldn't be revalidated, so its cached copy was used")
+}
+
+func TestPickImagePreset(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	configDir := path.Join(tempDir, "config")
+	assert.NoError(t, os.MkdirAll(path.Join(configDir, "wp"), 0755))
+	assert.NoError(t, ioutil.WriteFile(path.Join(configDir, "wp", "config.json"), []byte(`{"presets": {"thumbnail": "64x32"}}`), 0644))
+
+	cmd := exec.Command(binPath, "pick", "thumbnail", tempDir, "center", "--renderer", "native", sourceImage)
+	cmd.Env = append(os.Environ(), "XDG_CONFIG_HOME="+configDir)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	outputImage := path.Join(tempDir, "64x32", "wide_center.jpg")
+	assert.Equal(t, outputImage+"\n", string(output))
+
+	_, err = os.Stat(outputImage)
+	assert.NoError(t, err)
+
+	cmd = exec.Command(binPath, "presets")
+	cmd.Env = append(os.Environ(), "XDG_CONFIG_HOME="+configDir)
+
+	output, err = cmd.CombinedOutput()
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), "\n4k 3840x2160\n")
+	assert.Contains(t, string(output), "\nthumbnail 64x32\n")
+}
+
+func TestExtractOneImageBrokenConfig(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "square.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	configDir := path.Join(tempDir, "config")
+	assert.NoError(t, os.MkdirAll(path.Join(configDir, "wp"), 0755))
+	assert.NoError(t, ioutil.WriteFile(path.Join(configDir, "wp", "config.json"), []byte(`{"presets": [`), 0644))
+
+	// Commands that don't use a preset never read the config.
+	cmd := exec.Command(binPath, "extract", "64x64", tempDir, "--renderer", "native", sourceImage)
+	cmd.Env = append(os.Environ(), "XDG_CONFIG_HOME="+configDir)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(output))
+
+	_, err = os.Stat(path.Join(tempDir, "64x64", "square_center.jpg"))
+	assert.NoError(t, err)
+
+	cmd = exec.Command(binPath, "version")
+	cmd.Env = append(os.Environ(), "XDG_CONFIG_HOME="+configDir)
+
+	output, err = cmd.CombinedOutput()
+	assert.NoError(t, err, string(output))
+
+	cmd = exec.Command(binPath, "extract", "thumbnail", tempDir, "--renderer", "native", sourceImage)
+	cmd.Env = append(os.Environ(), "XDG_CONFIG_HOME="+configDir)
+
+	output, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "Failed to read config")
+}
+
+func TestPickImagePosition(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "pick", "64x64", tempDir, "0.35", "--scaled", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	outputImage := path.Join(tempDir, "64x64", "wide_scaled_0.35.jpg")
+	assert.Equal(t, outputImage+"\n", string(output))
+
+	_, err = os.Stat(outputImage)
+	assert.NoError(t, err)
+}
+
+func TestPickImageZoom(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "pick", "64x64", tempDir, "north", "--zoom", "1.5", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	outputImage := path.Join(tempDir, "64x64", "wide_scaled_1.5x_north.jpg")
+	assert.Equal(t, outputImage+"\n", string(output))
+
+	_, err = os.Stat(outputImage)
+	assert.NoError(t, err)
+}
+
+func TestExtractOneImageZoomTooLarge(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "square.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "extract", "64x64", tempDir, "--zoom", "3", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), "Image (square.jpg) is not wide enough to produce quality 64x64 output at 3x zoom\n")
+}
+
+func TestExtractOneImageMaxUpscale(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "extract", "260x130", tempDir, "--max-upscale", "1.1", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	outputImage := path.Join(tempDir, "260x130", "wide_scaled_center.jpg")
+	assert.Equal(t, outputImage+"\nImage (wide.jpg) was upscaled 1.02x to produce wide_scaled_center.jpg in 260x130\nImage (wide.jpg) is not wide enough to produce quality unscaled 260x130 output\n", string(output))
+
+	_, err = os.Stat(outputImage)
+	assert.NoError(t, err)
+}
+
+func TestExtractOneImageContained(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "tall.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "extract", "512x256", tempDir, "--fit", "contain", "--fill", "blur", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	outputImage := path.Join(tempDir, "512x256", "tall_contained_center.jpg")
+	assert.Equal(t, outputImage+"\n", string(output))
+
+	f, err := os.Open(outputImage)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(512, 256), image.Pt(config.Width, config.Height))
+}
+
+func TestExtractOneImageBadFill(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "extract", "64x64", tempDir, "--fit", "contain", "--fill", "mirror", "image.jpg")
+
+	output, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "Unknown fill (mirror)")
+}
+
+func TestSpanImage(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "span", "64x32+0+16,32x64+64+0", tempDir, "center", "--scaled", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	expectedOutput := ""
+	for i, size := range []image.Point{image.Pt(64, 32), image.Pt(32, 64)} {
+		outputImage := path.Join(tempDir, "96x64", fmt.Sprintf("wide_scaled_center_monitor%d.jpg", i+1))
+		expectedOutput += outputImage + "\n"
+
+		f, err := os.Open(outputImage)
+		assert.NoError(t, err)
+		config, _, err := image.DecodeConfig(f)
+		f.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, size, image.Pt(config.Width, config.Height))
+	}
+
+	assert.Equal(t, expectedOutput, string(output))
+}
+
+func TestSpanImageBadLayout(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "span", "64x32", tempDir, "center", "image.jpg")
+
+	output, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "Provided layout (64x32) is not valid")
+}
+
+func TestBezelImage(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// A 4mm bezel at 127 DPI hides 20 pixels, so the monitors cover 128x64,
+	//   which is exactly the scaled source.
+	cmd := exec.Command(binPath, "bezel", "64x64,44x64", tempDir, "--bezel-mm", "4", "--dpi", "127", "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	expectedOutput := ""
+	for i, size := range []image.Point{image.Pt(64, 64), image.Pt(44, 64)} {
+		outputImage := path.Join(tempDir, "128x64", fmt.Sprintf("wide_scaled_center_monitor%d.jpg", i+1))
+		expectedOutput += outputImage + "\n"
+
+		f, err := os.Open(outputImage)
+		assert.NoError(t, err)
+		config, _, err := image.DecodeConfig(f)
+		f.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, size, image.Pt(config.Width, config.Height))
+	}
+
+	assert.Equal(t, expectedOutput, string(output))
+}
+
+func TestBezelImageNoDpi(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "bezel", "64x64,64x64", tempDir, "--bezel-mm", "4", "image.jpg")
+
+	output, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "Bezel gap in millimetres needs a DPI to convert it to pixels")
+}
+
+func TestTileImage(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command(binPath, "tile", "128x128", tempDir, "--renderer", "native", sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+
+	expectedOutput := ""
+	for _, str := range []string{"r1_c1", "r1_c2"} {
+		outputImage := path.Join(tempDir, "128x128", "wide_tile_"+str+".jpg")
+		expectedOutput += outputImage + "\n"
+
+		_, err = os.Stat(outputImage)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, expectedOutput, string(output))
+}
+
+func TestTileImageUnsupportedFlags(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "wide.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Tiles are never scaled, so the flags that control scaling are rejected
+	//   rather than ignored.
+	for _, flag := range []string{"--zoom=2", "--filter=lanczos", "--sharpen=1"} {
+		cmd := exec.Command(binPath, "tile", "128x128", tempDir, flag, sourceImage)
+
+		output, err := cmd.CombinedOutput()
+		assert.Error(t, err)
+		assert.Contains(t, string(output), "unknown flag: "+strings.Split(flag, "=")[0])
+	}
+}
+
+func TestExtractOneImageNativeWebp(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, _ := filepath.Abs(path.Join(cwd, "test_images", "square.jpg"))
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Formats the renderer can't write are rejected before any image is.
+	cmd := exec.Command(binPath, "extract", "64x64", tempDir, "--format", "webp", "--renderer", "native", sourceImage, sourceImage)
+
+	output, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Equal(t, "Error: Native renderer can't write slices in format (webp); install ImageMagick, GraphicsMagick, or libvips to use it\n", strings.Split(string(output), "Usage:")[0])
+
+	_, err = os.Stat(path.Join(tempDir, "64x64"))
+	assert.True(t, os.IsNotExist(err))
+}
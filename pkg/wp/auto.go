@@ -0,0 +1,286 @@
+package wp
+
+import (
+	"image"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Gravity that places slices over the most interesting part of the source,
+//   rather than at a fixed position.
+const GravityAuto string = "Auto"
+
+// Longest side of the copy of the source that's analysed to place automatic
+//   slices; detail finer than this doesn't change where slices land.
+// Sources smaller than this are analysed as they are.
+const autoAnalysisSize int = 256
+
+// Most positions tried along each axis when placing automatic slices.
+const autoCandidates int = 16
+
+// Number of luminance buckets used to measure a region's entropy.
+const autoHistogramBuckets int = 32
+
+// Whether the gravity asks for slices to be placed automatically.
+func IsAutoGravity(gravity string) bool {
+	return strings.EqualFold(gravity, GravityAuto)
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func clampInt(v int, low int, high int) int {
+	if v < low {
+		return low
+	}
+	if v > high {
+		return high
+	}
+	return v
+}
+
+// Luminance and edge strength of every pixel of an image, with a summed area
+//   table of the edges so that any region's total can be found at once.
+type saliencyMap struct {
+	size      image.Point
+	luminance []uint8
+	edgeSums  []float64
+}
+
+func newSaliencyMap(img *image.RGBA) *saliencyMap {
+	size := img.Bounds().Size()
+	m := &saliencyMap{
+		size:      size,
+		luminance: make([]uint8, size.X*size.Y),
+		edgeSums:  make([]float64, (size.X+1)*(size.Y+1)),
+	}
+
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			p := img.Pix[img.PixOffset(x, y):]
+			m.luminance[y*size.X+x] = uint8((299*int(p[0]) + 587*int(p[1]) + 114*int(p[2])) / 1000)
+		}
+	}
+
+	at := func(x, y int) float64 {
+		return float64(m.luminance[clampInt(y, 0, size.Y-1)*size.X+clampInt(x, 0, size.X-1)])
+	}
+
+	stride := size.X + 1
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			edge := math.Abs(at(x+1, y)-at(x-1, y)) + math.Abs(at(x, y+1)-at(x, y-1))
+			m.edgeSums[(y+1)*stride+x+1] = edge + m.edgeSums[y*stride+x+1] + m.edgeSums[(y+1)*stride+x] - m.edgeSums[y*stride+x]
+		}
+	}
+
+	return m
+}
+
+// Score how interesting a region of the image is.
+// Regions score highly when they're both busy, with lots of strong edges, and
+//   varied, with a high entropy of luminance; flat regions score 0.
+func (m *saliencyMap) score(region image.Rectangle) float64 {
+	stride := m.size.X + 1
+	edges := m.edgeSums[region.Max.Y*stride+region.Max.X] -
+		m.edgeSums[region.Min.Y*stride+region.Max.X] -
+		m.edgeSums[region.Max.Y*stride+region.Min.X] +
+		m.edgeSums[region.Min.Y*stride+region.Min.X]
+
+	area := float64(region.Dx() * region.Dy())
+
+	histogram := make([]int, autoHistogramBuckets)
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			histogram[int(m.luminance[y*m.size.X+x])*autoHistogramBuckets/256]++
+		}
+	}
+
+	entropy := 0.0
+	for _, count := range histogram {
+		if count > 0 {
+			p := float64(count) / area
+			entropy -= p * math.Log2(p)
+		}
+	}
+
+	return edges / area * (1 + entropy)
+}
+
+// Get evenly spaced positions a window can take along an axis with the given
+//   amount of free space.
+func candidatePositions(free int) []int {
+	if free <= 0 {
+		return []int{0}
+	}
+
+	count := autoCandidates
+	if free+1 < count {
+		count = free + 1
+	}
+
+	positions := make([]int, count)
+	for i := range positions {
+		positions[i] = i * free / (count - 1)
+	}
+
+	return positions
+}
+
+// Find the top left corner of the most interesting window of the given size
+//   within the saliency map.
+// The centered window wins ties, so featureless images are cut as if they
+//   had been given the Center gravity.
+func (m *saliencyMap) bestWindow(window image.Point) image.Point {
+	free := m.size.Sub(window)
+
+	best := image.Pt(maxInt(free.X, 0)/2, maxInt(free.Y, 0)/2)
+	bestScore := m.score(image.Rectangle{best, best.Add(window)})
+
+	for _, y := range candidatePositions(free.Y) {
+		for _, x := range candidatePositions(free.X) {
+			candidate := image.Pt(x, y)
+			if score := m.score(image.Rectangle{candidate, candidate.Add(window)}); score > bestScore {
+				best, bestScore = candidate, score
+			}
+		}
+	}
+
+	return best
+}
+
+// Everything that determines what the copy of a source that's analysed
+//   looks like.
+type saliencyKey struct {
+	sourcePath string
+	rotate     int
+	flip       string
+}
+
+// The saliency map of one source, which is only made once, however many
+//   automatic slices are placed in it.
+type saliencyEntry struct {
+	once sync.Once
+	m    *saliencyMap
+	err  error
+}
+
+// Saliency maps of the sources automatic slices have been placed in, kept
+//   until the source is cleaned up.
+var saliencyMaps sync.Map
+
+// Get the saliency map of the request's source, upright and transformed,
+//   analysing it the first time it's needed.
+func sourceSaliency(req RenderRequest, renderer Renderer) (*saliencyMap, error) {
+	entry, _ := saliencyMaps.LoadOrStore(saliencyKey{req.SourcePath, req.Rotate, req.Flip}, &saliencyEntry{})
+	e := entry.(*saliencyEntry)
+	e.once.Do(func() {
+		e.m, e.err = analyseSource(req, renderer)
+	})
+
+	return e.m, e.err
+}
+
+// Forget the saliency maps of a source, however it was transformed.
+func forgetSaliency(sourcePath string) {
+	saliencyMaps.Range(func(key, value interface{}) bool {
+		if key.(saliencyKey).sourcePath == sourcePath {
+			saliencyMaps.Delete(key)
+		}
+		return true
+	})
+}
+
+// Build the saliency map of the request's source from a small png copy of
+//   it, made by the renderer, so that any source the renderer can read can
+//   have automatic slices placed in it.
+func analyseSource(req RenderRequest, renderer Renderer) (*saliencyMap, error) {
+	sourceSize, err := req.sourceSize()
+	if err != nil {
+		return nil, err
+	}
+
+	factor := math.Min(1, float64(autoAnalysisSize)/float64(maxInt(sourceSize.X, sourceSize.Y)))
+
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	analysis := RenderRequest{
+		SourcePath: req.SourcePath,
+		OutputPath: path.Join(tempDir, "analysis.png"),
+		Gravity:    "Center",
+		Size: image.Pt(
+			maxInt(int(math.Floor(float64(sourceSize.X)*factor+0.5)), 1),
+			maxInt(int(math.Floor(float64(sourceSize.Y)*factor+0.5)), 1),
+		),
+		Scaled: true,
+		Rotate: req.Rotate,
+		Flip:   req.Flip,
+		Filter: FilterBox,
+	}
+
+	if err := renderer.Render(analysis); err != nil {
+		return nil, err
+	}
+
+	img, err := decodeImage(analysis.OutputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSaliencyMap(img), nil
+}
+
+// Get the offset of the most interesting region of the request's source that
+//   its slice can cover.
+// The offset is relative to the scaled source for scaled slices. Along any
+//   axis the source doesn't cover, the slice is centered.
+func autoOffset(req RenderRequest, renderer Renderer) (image.Point, error) {
+	m, err := sourceSaliency(req, renderer)
+	if err != nil {
+		return image.ZP, err
+	}
+
+	sourceSize, err := req.sourceSize()
+	if err != nil {
+		return image.ZP, err
+	}
+
+	size := req.Size
+	frame := req.frame(sourceSize)
+
+	factor := float64(maxInt(m.size.X, m.size.Y)) / float64(maxInt(frame.X, frame.Y))
+	scale := func(p image.Point, limit image.Point) image.Point {
+		return image.Pt(
+			clampInt(int(math.Floor(float64(p.X)*factor+0.5)), 1, limit.X),
+			clampInt(int(math.Floor(float64(p.Y)*factor+0.5)), 1, limit.Y),
+		)
+	}
+
+	best := m.bestWindow(scale(size, m.size))
+
+	offset := image.Pt(
+		clampInt(int(math.Floor(float64(best.X)/factor+0.5)), 0, maxInt(frame.X-size.X, 0)),
+		clampInt(int(math.Floor(float64(best.Y)/factor+0.5)), 0, maxInt(frame.Y-size.Y, 0)),
+	)
+
+	if frame.X < size.X {
+		offset.X = frame.X/2 - size.X/2
+	}
+	if frame.Y < size.Y {
+		offset.Y = frame.Y/2 - size.Y/2
+	}
+
+	return offset, nil
+}
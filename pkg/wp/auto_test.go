@@ -0,0 +1,173 @@
+package wp
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+// Build a black image with a checkerboard covering the given region.
+func checkeredImage(size image.Point, detail image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			c := color.RGBA{0, 0, 0, 255}
+			if image.Pt(x, y).In(detail) && (x/2+y/2)%2 == 0 {
+				c = color.RGBA{255, 255, 255, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func writePng(t *testing.T, imagePath string, img image.Image) {
+	f, err := os.Create(imagePath)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	assert.NoError(t, png.Encode(f, img))
+}
+
+func TestIsAutoGravity(t *testing.T) {
+	assert.True(t, IsAutoGravity("auto"))
+	assert.True(t, IsAutoGravity("Auto"))
+	assert.False(t, IsAutoGravity("Center"))
+}
+
+func TestCandidatePositions(t *testing.T) {
+	assert.Equal(t, []int{0}, candidatePositions(0))
+	assert.Equal(t, []int{0, 1, 2}, candidatePositions(2))
+	assert.Equal(t, autoCandidates, len(candidatePositions(1000)))
+	assert.Equal(t, 1000, candidatePositions(1000)[autoCandidates-1])
+}
+
+func TestSaliencyMapBestWindow(t *testing.T) {
+	img := checkeredImage(image.Pt(64, 16), image.Rect(40, 0, 56, 16))
+
+	best := newSaliencyMap(img).bestWindow(image.Pt(16, 16))
+	assert.True(t, best.X >= 36 && best.X <= 44, "got %v", best)
+	assert.Equal(t, 0, best.Y)
+}
+
+func TestSaliencyMapBestWindowFlat(t *testing.T) {
+	img := checkeredImage(image.Pt(64, 32), image.ZR)
+
+	assert.Equal(t, image.Pt(24, 8), newSaliencyMap(img).bestWindow(image.Pt(16, 16)))
+}
+
+func TestAutoOffset(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	sourceImage := path.Join(tempDir, "detail.png")
+	writePng(t, sourceImage, checkeredImage(image.Pt(256, 128), image.Rect(0, 64, 64, 128)))
+
+	// Scaled to 128x64, the detail sits at the left of the scaled image.
+	offset, err := autoOffset(RenderRequest{SourcePath: sourceImage, Size: image.Pt(64, 64), Scaled: true}, &nativeRenderer{})
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(0, 0), offset)
+
+	offset, err = autoOffset(RenderRequest{SourcePath: sourceImage, Size: image.Pt(64, 64)}, &nativeRenderer{})
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(0, 64), offset)
+}
+
+func TestAutoOffsetSmallSource(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	sourceImage := path.Join(tempDir, "flat.png")
+	writePng(t, sourceImage, checkeredImage(image.Pt(32, 128), image.ZR))
+
+	offset, err := autoOffset(RenderRequest{SourcePath: sourceImage, Size: image.Pt(64, 64)}, &nativeRenderer{})
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(-16, 32), offset)
+}
+
+// Renders slices natively, counting how many it's asked for.
+type countingRenderer struct {
+	nativeRenderer
+	count int
+}
+
+func (r *countingRenderer) Render(req RenderRequest) error {
+	r.count++
+	return r.nativeRenderer.Render(req)
+}
+
+func TestAutoOffsetAnalysesOnce(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	sourceImage := path.Join(tempDir, "detail.png")
+	writePng(t, sourceImage, checkeredImage(image.Pt(512, 256), image.Rect(0, 128, 128, 256)))
+	defer forgetSaliency(sourceImage)
+
+	renderer := &countingRenderer{}
+	for _, req := range []RenderRequest{
+		{SourcePath: sourceImage, Size: image.Pt(128, 128)},
+		{SourcePath: sourceImage, Size: image.Pt(64, 64), Scaled: true},
+		{SourcePath: sourceImage, Size: image.Pt(64, 64), Scaled: true, Zoom: 2},
+	} {
+		_, err := autoOffset(req, renderer)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, renderer.count)
+
+	// The copy analysed is rotated along with the source.
+	offset, err := autoOffset(RenderRequest{SourcePath: sourceImage, Size: image.Pt(128, 128), Rotate: 90}, renderer)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(0, 0), offset)
+	assert.Equal(t, 2, renderer.count)
+
+	forgetSaliency(sourceImage)
+	offset, err = autoOffset(RenderRequest{SourcePath: sourceImage, Size: image.Pt(128, 128)}, renderer)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(0, 128), offset)
+	assert.Equal(t, 3, renderer.count)
+}
+
+func TestAutoOffsetNotFound(t *testing.T) {
+	_, err := autoOffset(RenderRequest{SourcePath: "/not/a/file.png", Size: image.Pt(64, 64)}, &nativeRenderer{})
+	assert.Error(t, err)
+}
+
+func TestExtractGravitiesFromLocalImageAuto(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	sourceImage := path.Join(tempDir, "detail.png")
+	writePng(t, sourceImage, checkeredImage(image.Pt(256, 128), image.Rect(192, 0, 256, 64)))
+
+	// The recording renderer can't make the copy of the source that's
+	//   analysed, so analyse it ahead of time.
+	_, err = sourceSaliency(RenderRequest{SourcePath: sourceImage}, &nativeRenderer{})
+	assert.NoError(t, err)
+	defer forgetSaliency(sourceImage)
+
+	renderer := &recordingRenderer{}
+
+	err = ExtractGravitiesFromLocalImage(sourceImage, false, []string{"auto"}, "64x64", tempDir, Options{Renderer: renderer, Log: ioutil.Discard})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []RenderRequest{{
+		SourcePath: sourceImage,
+		OutputPath: path.Join(tempDir, "detail_auto.png"),
+		Offset:     image.Pt(192, 0),
+		Size:       image.Pt(64, 64),
+	}}, renderer.reqs)
+}
@@ -0,0 +1,166 @@
+package wp
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"path"
+	"strings"
+)
+
+// Millimetres in an inch, for converting bezel widths to pixels.
+const millimetresPerInch float64 = 25.4
+
+// Get the number of pixels a bezel gap of the given width in millimetres
+//   hides, on monitors with the given pixel density.
+func BezelPixels(millimetres float64, dpi float64) int {
+	return int(math.Round(millimetres / millimetresPerInch * dpi))
+}
+
+// Check that a bezel gap is given either in pixels, or in millimetres along
+//   with the pixel density needed to convert it.
+func ValidateBezel(pixels int, millimetres float64, dpi float64) error {
+	if pixels < 0 || millimetres < 0 {
+		return errors.New("Bezel gap must not be negative")
+	}
+
+	if pixels > 0 && millimetres > 0 {
+		return errors.New("Bezel gap can't be given in both pixels and millimetres")
+	}
+
+	if millimetres > 0 && dpi <= 0 {
+		return errors.New("Bezel gap in millimetres needs a DPI to convert it to pixels")
+	}
+
+	return nil
+}
+
+// Lay out monitors of the given comma separated dimensions side by side, from
+//   left to right, with gap pixels hidden behind the bezels between each
+//   pair.
+// Monitors are centered vertically on the tallest of them.
+func ParseBezelLayout(str string, gap int) ([]image.Rectangle, error) {
+	var sizes []image.Point
+	height := 0
+	for _, dimensions := range strings.Split(str, ",") {
+		size, err := ParseDimensionsString(dimensions)
+		if err != nil {
+			return nil, err
+		}
+
+		sizes = append(sizes, size)
+		height = maxInt(height, size.Y)
+	}
+
+	monitors := make([]image.Rectangle, len(sizes))
+	x := 0
+	for i, size := range sizes {
+		offset := image.Pt(x, (height-size.Y)/2)
+		monitors[i] = image.Rectangle{offset, offset.Add(size)}
+		x += size.X + gap
+	}
+
+	return monitors, nil
+}
+
+/*
+  Cut one slice per monitor out of the source, for monitors that sit side by
+  side, skipping the part of the source that falls behind the bezels between
+  them so that lines running across the monitors stay straight.
+  The region covering every monitor, and the bezels between them, is placed
+  on the scaled source with the same gravities ExtractFromLocalImage takes
+  scaled slices with, and at each of the zoom levels in the options. Slices
+  are bucketed by the size of that region.
+*/
+func BezelFromLocalImage(dimensions string, gap int, destination string, localPath string, opts Options) error {
+	monitors, err := ParseBezelLayout(dimensions, gap)
+	if err != nil {
+		return err
+	}
+
+	size := layoutBounds(monitors).Size()
+
+	imageSize, err := GetImageDimensions(localPath)
+	if err != nil {
+		return err
+	}
+
+	destination, err = dimensionsBucket(destination, fmt.Sprintf("%dx%d", size.X, size.Y))
+	if err != nil {
+		return err
+	}
+
+	imageSize = rotatedSize(imageSize, opts.Rotate)
+	if err := checkImageSize(localPath, destination, imageSize, size, opts.maxUpscale()); err != nil {
+		return err
+	}
+
+	if err = osMkdirp(destination, 0755); err != nil {
+		return err
+	}
+
+	gravities, skipped := chooseScaledGravities(imageSize, size, opts)
+
+	var duplicates []string
+	for _, gravity := range skipped {
+		for i := range monitors {
+			duplicates = append(duplicates, GetOutputFilename(destination, opts.sliceName(monitorSliceName(gravity, i)), true, 0, localPath, opts.Format))
+		}
+	}
+
+	var reqs []RenderRequest
+	for _, gravity := range gravities {
+		gravityReqs, err := monitorRequests(localPath, imageSize, monitors, true, 0, gravity, destination, opts)
+		if err != nil {
+			return err
+		}
+
+		reqs = append(reqs, gravityReqs...)
+	}
+
+	upscale := upscaleFactor(imageSize, size)
+	softErrs := []error{upscaledError(localPath, upscale, reqs), duplicatesError(localPath, duplicates)}
+
+	// Zoomed regions have room to move in both directions, so are placed
+	//   with every gravity, like zoomed slices are when extracting.
+	for _, zoom := range opts.Zoom {
+		if zoom <= 1 {
+			continue
+		}
+
+		if float64(imageSize.X)*opts.maxUpscale() < float64(size.X)*zoom {
+			softErrs = append(softErrs, errors.New(fmt.Sprintf("Image (%s) is not wide enough to produce quality %s output at %s zoom", path.Base(localPath), path.Base(destination), zoomString(zoom))))
+			continue
+		}
+
+		if float64(imageSize.Y)*opts.maxUpscale() < float64(size.Y)*zoom {
+			softErrs = append(softErrs, errors.New(fmt.Sprintf("Image (%s) is not tall enough to produce quality %s output at %s zoom", path.Base(localPath), path.Base(destination), zoomString(zoom))))
+			continue
+		}
+
+		var zoomReqs []RenderRequest
+		for _, gravity := range unscaledGravities {
+			gravityReqs, err := monitorRequests(localPath, imageSize, monitors, true, zoom, gravity, destination, opts)
+			if err != nil {
+				return err
+			}
+
+			zoomReqs = append(zoomReqs, gravityReqs...)
+		}
+
+		softErrs = append(softErrs, upscaledError(localPath, upscale*zoom, zoomReqs))
+		reqs = append(reqs, zoomReqs...)
+	}
+
+	renderErr := renderRequests(opts.renderer(), reqs)
+	if err := MultiErrorFromErrors(append(softErrs, renderErr)); err.Exists() {
+		return err
+	}
+
+	return nil
+}
+
+func BezelFromImage(dimensions string, gap int, destination string, imageSource *ImageSource, opts Options) error {
+	return BezelFromLocalImage(dimensions, gap, destination, imageSource.LocalPath, opts)
+}
@@ -0,0 +1,99 @@
+package wp
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBezelPixels(t *testing.T) {
+	assert.Equal(t, 0, BezelPixels(0, 96))
+	assert.Equal(t, 96, BezelPixels(25.4, 96))
+	assert.Equal(t, 43, BezelPixels(10, 109))
+}
+
+func TestValidateBezel(t *testing.T) {
+	assert.NoError(t, ValidateBezel(0, 0, 0))
+	assert.NoError(t, ValidateBezel(40, 0, 0))
+	assert.NoError(t, ValidateBezel(0, 10, 109))
+
+	assert.Equal(t, "Bezel gap must not be negative", ValidateBezel(-1, 0, 0).Error())
+	assert.Equal(t, "Bezel gap must not be negative", ValidateBezel(0, -1, 96).Error())
+	assert.Equal(t, "Bezel gap can't be given in both pixels and millimetres", ValidateBezel(40, 10, 109).Error())
+	assert.Equal(t, "Bezel gap in millimetres needs a DPI to convert it to pixels", ValidateBezel(0, 10, 0).Error())
+}
+
+func TestParseBezelLayout(t *testing.T) {
+	monitors, err := ParseBezelLayout("2560x1440,1920x1080,2560x1440", 40)
+	assert.NoError(t, err)
+	assert.Equal(t, []image.Rectangle{
+		image.Rect(0, 0, 2560, 1440),
+		image.Rect(2600, 180, 4520, 1260),
+		image.Rect(4560, 0, 7120, 1440),
+	}, monitors)
+
+	_, err = ParseBezelLayout("2560x1440,abc", 40)
+	assert.Equal(t, "Provided dimension string (abc) is not valid", err.Error())
+}
+
+func TestBezelFromLocalImage(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// The monitors and the bezel between them cover 112x64, which the 256x128
+	//   source is scaled to 128x64 to cover, leaving it room to move across.
+	renderer := &recordingRenderer{}
+	err = BezelFromLocalImage("64x64,32x48", 16, tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard})
+	assert.NoError(t, err)
+
+	outputDir := path.Join(tempDir, "112x64")
+	assert.Equal(t, 6, len(renderer.reqs))
+	for i, expected := range []struct {
+		name   string
+		offset image.Point
+		size   image.Point
+	}{
+		{"west_monitor1", image.Pt(0, 0), image.Pt(64, 64)},
+		{"west_monitor2", image.Pt(80, 8), image.Pt(32, 48)},
+		{"center_monitor1", image.Pt(8, 0), image.Pt(64, 64)},
+		{"center_monitor2", image.Pt(88, 8), image.Pt(32, 48)},
+		{"east_monitor1", image.Pt(16, 0), image.Pt(64, 64)},
+		{"east_monitor2", image.Pt(96, 8), image.Pt(32, 48)},
+	} {
+		req := renderer.reqs[i]
+		assert.Equal(t, path.Join(outputDir, "wide_scaled_"+expected.name+".jpg"), req.OutputPath)
+		assert.Equal(t, expected.offset, req.Offset)
+		assert.Equal(t, expected.size, req.Size)
+		assert.Equal(t, image.Pt(112, 64), req.Cover)
+		assert.True(t, req.Scaled)
+	}
+}
+
+func TestBezelFromLocalImageTooSmall(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	err = BezelFromLocalImage("128x128,128x128", 16, tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard})
+	assert.Equal(t, "Image (wide.jpg) is not wide enough to produce quality 272x128 output", err.Error())
+	assert.Equal(t, 0, len(renderer.reqs))
+}
@@ -0,0 +1,343 @@
+package wp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used by downloads that don't set their own timeouts or size limit.
+const (
+	DefaultConnectTimeout time.Duration = 10 * time.Second
+	DefaultReadTimeout    time.Duration = 30 * time.Second
+	DefaultMaxDownload    int64         = 100 * 1024 * 1024
+)
+
+// Options controlling how remote sources are downloaded.
+// The zero value uses the default timeouts and size limit, and never
+//   retries.
+type DownloadOptions struct {
+	// Longest to wait to connect to the host, and for the host to respond,
+	//   or send more of the body, once connected.
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+
+	// Number of times to try a download again after it fails in a way that
+	//   might not happen the next time, like a timeout or a 5xx response.
+	Retries int
+
+	// Largest source, in bytes, that will be downloaded.
+	MaxSize int64
+
+	// Whether to ask the host if cached sources have changed before using
+	//   them, either every time, or once they were fetched longer ago than
+	//   MaxAge; changed sources are downloaded again.
+	Revalidate bool
+	MaxAge     time.Duration
+
+	// Whether to only use sources that are already cached, and fail for
+	//   any others rather than downloading them.
+	Offline bool
+}
+
+// What's known about a cached source; kept alongside it in the cache so the
+//   host can later be asked whether it's changed, and so the image only has
+//   to be checked for being whole once, when it's written.
+type DownloadMetadata struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	Size         int64     `json:"size,omitempty"`
+}
+
+// Returned by downloads whose source hasn't changed since it was previously
+//   downloaded.
+var errNotModified error = errors.New("Not modified")
+
+// Returned by downloads that failed in a way that might not happen again, once
+//   they've been tried as many times as they're allowed.
+type transientError struct {
+	error
+}
+
+func (o DownloadOptions) connectTimeout() time.Duration {
+	if o.ConnectTimeout <= 0 {
+		return DefaultConnectTimeout
+	}
+
+	return o.ConnectTimeout
+}
+
+func (o DownloadOptions) readTimeout() time.Duration {
+	if o.ReadTimeout <= 0 {
+		return DefaultReadTimeout
+	}
+
+	return o.ReadTimeout
+}
+
+func (o DownloadOptions) maxSize() int64 {
+	if o.MaxSize <= 0 {
+		return DefaultMaxDownload
+	}
+
+	return o.MaxSize
+}
+
+// Clients shared by downloads with the same timeouts, so that connections to
+//   a host are kept alive and reused, rather than every download leaving one
+//   of its own idle.
+var downloadClients sync.Map
+
+func (o DownloadOptions) client() *http.Client {
+	key := [2]time.Duration{o.connectTimeout(), o.readTimeout()}
+	if client, ok := downloadClients.Load(key); ok {
+		return client.(*http.Client)
+	}
+
+	client, _ := downloadClients.LoadOrStore(key, &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: o.connectTimeout()}).DialContext,
+			TLSHandshakeTimeout:   o.connectTimeout(),
+			ResponseHeaderTimeout: o.readTimeout(),
+		},
+	})
+	return client.(*http.Client)
+}
+
+// Get how long to wait before trying a failed download again, given how many
+//   times it's been tried already.
+var retryDelay func(attempt int) time.Duration = func(attempt int) time.Duration {
+	return time.Duration(1<<uint(attempt)) * 500 * time.Millisecond
+}
+
+type FileDownloader func(destFile, sourceUrl string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error)
+
+// Download the source at the URL to destFile, trying again with a growing
+//   delay for as long as it fails in ways that might not happen again.
+// If the source was downloaded before, the host is only asked for it if it's
+//   changed since, and errNotModified is returned if it hasn't.
+// Nothing is left at destFile if the download fails.
+var downloadFile FileDownloader = func(destFile, sourceUrl string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error) {
+	for attempt := 0; ; attempt++ {
+		metadata, transient, err := downloadOnce(destFile, sourceUrl, opts, previous)
+		if err == nil {
+			return metadata, nil
+		}
+
+		os.Remove(destFile)
+		if !transient {
+			return DownloadMetadata{}, err
+		}
+
+		if attempt >= opts.Retries {
+			return DownloadMetadata{}, transientError{err}
+		}
+
+		time.Sleep(retryDelay(attempt))
+	}
+}
+
+// Check whether a response with the given status is worth trying again.
+func transientStatus(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests || status == http.StatusRequestTimeout
+}
+
+// Check that a response's content type allows for an image.
+// Servers that don't know what they're sending are given the benefit of the
+//   doubt, and the body is checked instead.
+func imageContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "image/") || mediaType == "application/octet-stream" || mediaType == "binary/octet-stream"
+}
+
+// Get the format of the image that starts with the given bytes, or an empty
+//   string if they don't look like any image.
+func sniffImageFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xff, 0xd8, 0xff}):
+		return "jpeg"
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return "gif"
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return "webp"
+	case bytes.HasPrefix(header, []byte("BM")):
+		return "bmp"
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return "tiff"
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		switch string(header[8:12]) {
+		case "avif", "avis":
+			return "avif"
+		case "heic", "heix", "hevc", "hevx", "mif1", "msf1":
+			return "heic"
+		}
+	}
+
+	return ""
+}
+
+// The extensions of each format sniffImageFormat recognizes, starting with
+//   the one given to downloads that don't have any of them.
+var imageFormatExtensions map[string][]string = map[string][]string{
+	"jpeg": []string{".jpg", ".jpeg", ".jpe", ".jfif"},
+	"png":  []string{".png"},
+	"gif":  []string{".gif"},
+	"webp": []string{".webp"},
+	"bmp":  []string{".bmp"},
+	"tiff": []string{".tiff", ".tif"},
+	"avif": []string{".avif"},
+	"heic": []string{".heic", ".heif"},
+}
+
+// Get the format of the image at the path, or an empty string if it doesn't
+//   look like any image.
+func sniffImageFile(imagePath string) string {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	header := make([]byte, 16)
+	n, _ := io.ReadFull(f, header)
+	return sniffImageFormat(header[:n])
+}
+
+// A reader that cancels its request if reading from it ever stalls for
+//   longer than the timeout.
+type stallReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.timer.Reset(r.timeout)
+	return n, err
+}
+
+// Try the download once.
+// Returns what's known about the downloaded source, or whether the failure,
+//   if there was one, might not happen again.
+func downloadOnce(destFile, sourceUrl string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var metadata DownloadMetadata
+	req, err := http.NewRequest(http.MethodGet, sourceUrl, nil)
+	if err != nil {
+		return metadata, false, err
+	}
+
+	if previous.ETag != "" {
+		req.Header.Set("If-None-Match", previous.ETag)
+	}
+
+	if previous.LastModified != "" {
+		req.Header.Set("If-Modified-Since", previous.LastModified)
+	}
+
+	resp, err := opts.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return metadata, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && (previous.ETag != "" || previous.LastModified != "") {
+		return metadata, false, errNotModified
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return metadata, transientStatus(resp.StatusCode), errors.New(fmt.Sprintf("Download of (%s) failed with status (%s)", sourceUrl, resp.Status))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !imageContentType(contentType) {
+		return metadata, false, errors.New(fmt.Sprintf("Download of (%s) is not an image (%s)", sourceUrl, contentType))
+	}
+
+	maxSize := opts.maxSize()
+	if resp.ContentLength > maxSize {
+		return metadata, false, errors.New(fmt.Sprintf("Download of (%s) is larger than the maximum size (%d bytes)", sourceUrl, maxSize))
+	}
+
+	timer := time.AfterFunc(opts.readTimeout(), cancel)
+	defer timer.Stop()
+	body := &stallReader{io.LimitReader(resp.Body, maxSize+1), timer, opts.readTimeout()}
+
+	header := make([]byte, 16)
+	n, err := io.ReadFull(body, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return metadata, true, readError(ctx, sourceUrl, err)
+	}
+
+	header = header[:n]
+	if sniffImageFormat(header) == "" {
+		return metadata, false, errors.New(fmt.Sprintf("Download of (%s) is not an image", sourceUrl))
+	}
+
+	out, err := os.Create(destFile)
+	if err != nil {
+		return metadata, false, err
+	}
+	defer out.Close()
+
+	if _, err := out.Write(header); err != nil {
+		return metadata, false, err
+	}
+
+	written, err := io.Copy(out, body)
+	if err != nil {
+		return metadata, true, readError(ctx, sourceUrl, err)
+	}
+
+	if int64(n)+written > maxSize {
+		return metadata, false, errors.New(fmt.Sprintf("Download of (%s) is larger than the maximum size (%d bytes)", sourceUrl, maxSize))
+	}
+
+	if err := out.Close(); err != nil {
+		return metadata, false, err
+	}
+
+	metadata = DownloadMetadata{
+		URL:          sourceUrl,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+
+	return metadata, false, nil
+}
+
+// Describe an error reading the body of a download, which is caused by the
+//   request being cancelled if reading stalled.
+func readError(ctx context.Context, sourceUrl string, err error) error {
+	if ctx.Err() != nil {
+		return errors.New(fmt.Sprintf("Download of (%s) timed out", sourceUrl))
+	}
+
+	return err
+}
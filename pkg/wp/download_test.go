@@ -0,0 +1,244 @@
+package wp
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+// Don't wait between retries in tests.
+func mockRetryDelay() func() {
+	f := retryDelay
+	retryDelay = func(attempt int) time.Duration {
+		return 0
+	}
+
+	return func() {
+		retryDelay = f
+	}
+}
+
+// Serve the square test image from a handler.
+func serveSquare(t *testing.T, w http.ResponseWriter, contentType string) {
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(sourceImage)
+	assert.NoError(t, err)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(contents)
+}
+
+func TestSniffImageFormat(t *testing.T) {
+	assert.Equal(t, "jpeg", sniffImageFormat([]byte{0xff, 0xd8, 0xff, 0xe0}))
+	assert.Equal(t, "png", sniffImageFormat([]byte("\x89PNG\r\n\x1a\n\x00\x00")))
+	assert.Equal(t, "gif", sniffImageFormat([]byte("GIF89a")))
+	assert.Equal(t, "webp", sniffImageFormat([]byte("RIFF\x00\x00\x00\x00WEBPVP8 ")))
+	assert.Equal(t, "tiff", sniffImageFormat([]byte("MM\x00*\x00\x00\x00\x08")))
+	assert.Equal(t, "avif", sniffImageFormat([]byte("\x00\x00\x00\x1cftypavif")))
+	assert.Equal(t, "heic", sniffImageFormat([]byte("\x00\x00\x00\x18ftypheic")))
+	assert.Equal(t, "", sniffImageFormat([]byte("\x00\x00\x00\x18ftypmp42")))
+	assert.Equal(t, "", sniffImageFormat([]byte("<!DOCTYPE html>")))
+	assert.Equal(t, "", sniffImageFormat(nil))
+}
+
+func TestImageContentType(t *testing.T) {
+	assert.True(t, imageContentType(""))
+	assert.True(t, imageContentType("image/jpeg"))
+	assert.True(t, imageContentType("image/png; charset=binary"))
+	assert.True(t, imageContentType("application/octet-stream"))
+	assert.False(t, imageContentType("text/html; charset=utf-8"))
+	assert.False(t, imageContentType("application/json"))
+}
+
+func TestDownloadFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveSquare(t, w, "image/jpeg")
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	destFile := path.Join(tempDir, "square.jpg")
+	_, err = downloadFile(destFile, server.URL+"/square.jpg", DownloadOptions{}, DownloadMetadata{})
+	assert.NoError(t, err)
+
+	size, err := GetImageDimensions(destFile)
+	assert.NoError(t, err)
+	assert.Equal(t, 128, size.X)
+}
+
+func TestDownloadFileReusesConnections(t *testing.T) {
+	connections := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveSquare(t, w, "image/jpeg")
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections++
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	for i := 0; i < 3; i++ {
+		_, err = downloadFile(path.Join(tempDir, "square.jpg"), server.URL+"/square.jpg", DownloadOptions{}, DownloadMetadata{})
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, connections)
+	assert.True(t, DownloadOptions{}.client() == DownloadOptions{ReadTimeout: DefaultReadTimeout}.client())
+	assert.False(t, DownloadOptions{}.client() == DownloadOptions{ReadTimeout: time.Second}.client())
+}
+
+func TestDownloadFileNotFound(t *testing.T) {
+	defer mockRetryDelay()()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<html>Not Found</html>"))
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	destFile := path.Join(tempDir, "image.jpg")
+	_, err = downloadFile(destFile, server.URL+"/image.jpg", DownloadOptions{Retries: 3}, DownloadMetadata{})
+	assert.Equal(t, "Download of ("+server.URL+"/image.jpg) failed with status (404 Not Found)", err.Error())
+
+	// Missing images won't turn up by asking again.
+	assert.Equal(t, 1, requests)
+
+	_, err = os.Stat(destFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadFileRetries(t *testing.T) {
+	defer mockRetryDelay()()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		serveSquare(t, w, "image/jpeg")
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	destFile := path.Join(tempDir, "square.jpg")
+	_, err = downloadFile(destFile, server.URL+"/square.jpg", DownloadOptions{Retries: 1}, DownloadMetadata{})
+	assert.Equal(t, "Download of ("+server.URL+"/square.jpg) failed with status (503 Service Unavailable)", err.Error())
+	assert.Equal(t, 2, requests)
+
+	requests = 0
+	_, err = downloadFile(destFile, server.URL+"/square.jpg", DownloadOptions{Retries: 2}, DownloadMetadata{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, requests)
+}
+
+func TestDownloadFileNotImage(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html>Sign in to continue</html>"))
+	}))
+
+	destFile := path.Join(tempDir, "image.jpg")
+	_, err = downloadFile(destFile, server.URL+"/image.jpg", DownloadOptions{}, DownloadMetadata{})
+	assert.Equal(t, "Download of ("+server.URL+"/image.jpg) is not an image (text/html; charset=utf-8)", err.Error())
+	server.Close()
+
+	// Servers that don't say what they're sending have the body checked.
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("<html>Sign in to continue</html>"))
+	}))
+	defer server.Close()
+
+	_, err = downloadFile(destFile, server.URL+"/image.jpg", DownloadOptions{}, DownloadMetadata{})
+	assert.Equal(t, "Download of ("+server.URL+"/image.jpg) is not an image", err.Error())
+
+	_, err = os.Stat(destFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadFileTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveSquare(t, w, "image/jpeg")
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	destFile := path.Join(tempDir, "square.jpg")
+	_, err = downloadFile(destFile, server.URL+"/square.jpg", DownloadOptions{MaxSize: 100}, DownloadMetadata{})
+	assert.Equal(t, "Download of ("+server.URL+"/square.jpg) is larger than the maximum size (100 bytes)", err.Error())
+
+	_, err = os.Stat(destFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadFileStalls(t *testing.T) {
+	defer mockRetryDelay()()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte{0xff, 0xd8, 0xff, 0xe0})
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	destFile := path.Join(tempDir, "image.jpg")
+	_, err = downloadFile(destFile, server.URL+"/image.jpg", DownloadOptions{ReadTimeout: 50 * time.Millisecond, Retries: 1}, DownloadMetadata{})
+	assert.Equal(t, "Download of ("+server.URL+"/image.jpg) timed out", err.Error())
+	assert.Equal(t, 2, requests)
+
+	_, err = os.Stat(destFile)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,123 @@
+package wp
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ways a scaled source can be fitted to a slice.
+// Covering fills the slice and crops whatever falls outside of it, while
+//   containing keeps the whole source within the slice, and fills whatever
+//   it doesn't cover.
+const (
+	FitCover   string = "cover"
+	FitContain string = "contain"
+)
+
+// Fills for the area of a slice a contained source doesn't cover, other than
+//   solid colours.
+// Edge fills repeat the outermost pixels of the source outwards, and blur
+//   fills use a blurred and darkened copy of the source scaled to cover the
+//   slice.
+const (
+	FillEdge string = "edge"
+	FillBlur string = "blur"
+)
+
+// Colour contained slices are filled with when no fill is given.
+const DefaultFill string = "black"
+
+// Sigma of the blur applied to the background of blur filled slices, and how
+//   much the background's brightness is scaled by.
+const (
+	fillBlurSigma  float64 = 20
+	fillBlurDarken float64 = 0.6
+)
+
+var hexColorRegexp *regexp.Regexp = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+var namedColors map[string]color.RGBA = map[string]color.RGBA{
+	"black": color.RGBA{0, 0, 0, 255},
+	"white": color.RGBA{255, 255, 255, 255},
+	"gray":  color.RGBA{128, 128, 128, 255},
+	"grey":  color.RGBA{128, 128, 128, 255},
+	"red":   color.RGBA{255, 0, 0, 255},
+	"green": color.RGBA{0, 128, 0, 255},
+	"blue":  color.RGBA{0, 0, 255, 255},
+}
+
+// Parse a solid fill colour; either one of a few names, or a hex colour like
+//   #123 or #112233.
+func parseFillColor(fill string) (color.RGBA, bool) {
+	if c, ok := namedColors[strings.ToLower(fill)]; ok {
+		return c, true
+	}
+
+	if !hexColorRegexp.MatchString(fill) {
+		return color.RGBA{}, false
+	}
+
+	hex := fill[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	value, _ := strconv.ParseUint(hex, 16, 32)
+	return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 255}, true
+}
+
+// Get the colour a request's solid fill uses.
+func (req RenderRequest) fillColor() color.RGBA {
+	if c, ok := parseFillColor(req.Fill); ok {
+		return c
+	}
+
+	c, _ := parseFillColor(DefaultFill)
+	return c
+}
+
+// Whether the request keeps the whole source within the slice.
+func (req RenderRequest) contained() bool {
+	return req.Scaled && req.Fit == FitContain
+}
+
+// Get where the top left corner of a contained source of the given size
+//   falls within the slice.
+func (req RenderRequest) containOffset(fitted image.Point) (image.Point, error) {
+	return gravityOffset(req.Gravity, req.Size, fitted)
+}
+
+// Split out the requests that contain their source, since they can't share
+//   a scaled copy of the source with slices that cover it.
+func splitContained(reqs []RenderRequest) ([]RenderRequest, []RenderRequest) {
+	var contained []RenderRequest
+	var rest []RenderRequest
+	for _, req := range reqs {
+		if req.contained() {
+			contained = append(contained, req)
+		} else {
+			rest = append(rest, req)
+		}
+	}
+
+	return contained, rest
+}
+
+// Check that the fit, and the fill used by contained slices, are understood.
+// Empty strings are treated as the defaults.
+func ValidateFit(fit string, fill string) error {
+	if fit != "" && fit != FitCover && fit != FitContain {
+		return errors.New(fmt.Sprintf("Unknown fit (%s)", fit))
+	}
+
+	if _, ok := parseFillColor(fill); ok || fill == "" || fill == FillEdge || fill == FillBlur {
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf("Unknown fill (%s)", fill))
+}
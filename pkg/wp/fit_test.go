@@ -0,0 +1,66 @@
+package wp
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFillColor(t *testing.T) {
+	expected := map[string]color.RGBA{
+		"black":   color.RGBA{0, 0, 0, 255},
+		"White":   color.RGBA{255, 255, 255, 255},
+		"#123":    color.RGBA{0x11, 0x22, 0x33, 255},
+		"#a0b1C2": color.RGBA{0xa0, 0xb1, 0xc2, 255},
+	}
+
+	for fill, c := range expected {
+		parsed, ok := parseFillColor(fill)
+		assert.True(t, ok, fill)
+		assert.Equal(t, c, parsed, fill)
+	}
+
+	for _, fill := range []string{"", "#12", "#1234567", "123456", "chartreuse", FillBlur} {
+		_, ok := parseFillColor(fill)
+		assert.False(t, ok, fill)
+	}
+}
+
+func TestRenderRequestFillColor(t *testing.T) {
+	assert.Equal(t, color.RGBA{0, 0, 0, 255}, RenderRequest{}.fillColor())
+	assert.Equal(t, color.RGBA{0, 0, 0, 255}, RenderRequest{Fill: FillEdge}.fillColor())
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, RenderRequest{Fill: "white"}.fillColor())
+}
+
+func TestRenderRequestContained(t *testing.T) {
+	assert.True(t, RenderRequest{Scaled: true, Fit: FitContain}.contained())
+	assert.False(t, RenderRequest{Fit: FitContain}.contained())
+	assert.False(t, RenderRequest{Scaled: true, Fit: FitCover}.contained())
+
+	offset, err := RenderRequest{Gravity: "East", Size: image.Pt(256, 64)}.containOffset(image.Pt(32, 64))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(224, 0), offset)
+}
+
+func TestSplitContained(t *testing.T) {
+	a := RenderRequest{OutputPath: "a", Scaled: true, Fit: FitContain}
+	b := RenderRequest{OutputPath: "b", Scaled: true}
+	c := RenderRequest{OutputPath: "c", Fit: FitContain}
+
+	contained, rest := splitContained([]RenderRequest{a, b, c})
+	assert.Equal(t, []RenderRequest{a}, contained)
+	assert.Equal(t, []RenderRequest{b, c}, rest)
+}
+
+func TestValidateFit(t *testing.T) {
+	assert.NoError(t, ValidateFit("", ""))
+	assert.NoError(t, ValidateFit(FitCover, DefaultFill))
+	assert.NoError(t, ValidateFit(FitContain, FillBlur))
+	assert.NoError(t, ValidateFit(FitContain, "#112233"))
+	assert.Equal(t, "Unknown fit (stretch)", ValidateFit("stretch", "").Error())
+	assert.Equal(t, "Unknown fill (mirror)", ValidateFit(FitContain, "mirror").Error())
+}
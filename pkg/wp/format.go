@@ -0,0 +1,49 @@
+package wp
+
+import (
+	"path"
+	"strings"
+)
+
+// Formats that slices can be written in.
+const (
+	FormatPNG  string = "png"
+	FormatJPEG string = "jpeg"
+	FormatWebP string = "webp"
+	FormatAVIF string = "avif"
+)
+
+// The extension given to slices written in each format.
+var formatExtensions map[string]string = map[string]string{
+	FormatPNG:  ".png",
+	FormatJPEG: ".jpg",
+	FormatWebP: ".webp",
+	FormatAVIF: ".avif",
+}
+
+// Get the extension of a slice of the source written in the given format.
+// If no format is given, slices keep the source's extension.
+func outputExtension(sourcePath string, format string) string {
+	if extension, ok := formatExtensions[format]; ok {
+		return extension
+	}
+
+	return path.Ext(sourcePath)
+}
+
+// Get the format a slice written to the given path will be written in, based
+//   on its extension.
+func formatOfPath(outputPath string) string {
+	extension := strings.ToLower(path.Ext(outputPath))
+	if extension == ".jpeg" {
+		return FormatJPEG
+	}
+
+	for format, formatExtension := range formatExtensions {
+		if extension == formatExtension {
+			return format
+		}
+	}
+
+	return strings.TrimPrefix(extension, ".")
+}
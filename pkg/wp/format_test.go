@@ -0,0 +1,24 @@
+package wp
+
+import (
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputExtension(t *testing.T) {
+	assert.Equal(t, ".png", outputExtension("image.png", ""))
+	assert.Equal(t, ".jpg", outputExtension("image.png", FormatJPEG))
+	assert.Equal(t, ".webp", outputExtension("image.jpeg", FormatWebP))
+	assert.Equal(t, ".avif", outputExtension("image", FormatAVIF))
+}
+
+func TestFormatOfPath(t *testing.T) {
+	assert.Equal(t, FormatJPEG, formatOfPath("a/b.jpg"))
+	assert.Equal(t, FormatJPEG, formatOfPath("a/b.JPEG"))
+	assert.Equal(t, FormatPNG, formatOfPath("b.png"))
+	assert.Equal(t, FormatWebP, formatOfPath("b.webp"))
+	assert.Equal(t, "gif", formatOfPath("b.gif"))
+}
@@ -0,0 +1,139 @@
+package wp
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var positionRegexp *regexp.Regexp = regexp.MustCompile(`^[01](?:\.\d+)?$`)
+
+// Get the size an image of the given size would be scaled to so that it
+//   completely covers the target size, while maintaining its aspect ratio.
+// Mirrors the geometry ImageMagick computes for `-scale WxH^`.
+func scaleToFill(size image.Point, target image.Point) image.Point {
+	scaleX := float64(target.X) / float64(size.X)
+	scaleY := float64(target.Y) / float64(size.Y)
+	scale := math.Max(scaleX, scaleY)
+
+	return image.Pt(
+		int(math.Floor(scale*float64(size.X)+0.5)),
+		int(math.Floor(scale*float64(size.Y)+0.5)),
+	)
+}
+
+// Get the size an image of the given size would be scaled to so that it fits
+//   entirely within the target size, while maintaining its aspect ratio.
+// Mirrors the geometry ImageMagick computes for `-resize WxH`.
+func scaleToFit(size image.Point, target image.Point) image.Point {
+	scaleX := float64(target.X) / float64(size.X)
+	scaleY := float64(target.Y) / float64(size.Y)
+	scale := math.Min(scaleX, scaleY)
+
+	return image.Pt(
+		int(math.Max(1, math.Floor(scale*float64(size.X)+0.5))),
+		int(math.Max(1, math.Floor(scale*float64(size.Y)+0.5))),
+	)
+}
+
+// Get how much an image of the given size has to be enlarged by to cover the
+//   target size; 1 or less means it doesn't need to be.
+func upscaleFactor(size image.Point, target image.Point) float64 {
+	return math.Max(float64(target.X)/float64(size.X), float64(target.Y)/float64(size.Y))
+}
+
+// Get the offset of a region of size inner placed within a region of size
+//   outer with the given gravity.
+// Mirrors the integer arithmetic ImageMagick uses for `-gravity`, so that
+//   native crops land on the same pixels as `-extent` does.
+func gravityOffset(gravity string, outer image.Point, inner image.Point) (image.Point, error) {
+	centerX := outer.X/2 - inner.X/2
+	centerY := outer.Y/2 - inner.Y/2
+	endX := outer.X - inner.X
+	endY := outer.Y - inner.Y
+
+	switch strings.ToLower(gravity) {
+	case "northwest":
+		return image.Pt(0, 0), nil
+	case "north":
+		return image.Pt(centerX, 0), nil
+	case "northeast":
+		return image.Pt(endX, 0), nil
+	case "west":
+		return image.Pt(0, centerY), nil
+	case "center":
+		return image.Pt(centerX, centerY), nil
+	case "east":
+		return image.Pt(endX, centerY), nil
+	case "southwest":
+		return image.Pt(0, endY), nil
+	case "south":
+		return image.Pt(centerX, endY), nil
+	case "southeast":
+		return image.Pt(endX, endY), nil
+	}
+
+	return image.ZP, errors.New(fmt.Sprintf("Unknown gravity (%s)", gravity))
+}
+
+// Parse a fractional position along the long axis of a source, running from
+//   0 at its left or top edge, to 1 at its right or bottom edge.
+// Returns false if the string isn't a position, so that it can be treated as
+//   a gravity instead.
+func ParsePosition(str string) (float64, bool) {
+	if !positionRegexp.MatchString(str) {
+		return 0, false
+	}
+
+	position, err := strconv.ParseFloat(str, 64)
+	if err != nil || position > 1 {
+		return 0, false
+	}
+
+	return position, true
+}
+
+// Get the given number of evenly spaced positions, from one edge to the
+//   other, formatted the way they appear in filenames.
+// A single step is placed in the middle.
+func stepPositions(steps int) []string {
+	if steps == 1 {
+		return []string{"0.5"}
+	}
+
+	positions := make([]string, steps)
+	for i := range positions {
+		position := math.Floor(float64(i)/float64(steps-1)*10000+0.5) / 10000
+		positions[i] = strconv.FormatFloat(position, 'f', -1, 64)
+	}
+
+	return positions
+}
+
+// Get the offset of a region of size inner placed at a fractional position
+//   within a region of size outer.
+// The position applies along whichever axis has the most room to spare, and
+//   the region is centered along the other.
+func positionOffset(position float64, outer image.Point, inner image.Point) image.Point {
+	free := outer.Sub(inner)
+	offset := image.Pt(outer.X/2-inner.X/2, outer.Y/2-inner.Y/2)
+
+	if free.X >= free.Y {
+		if free.X > 0 {
+			offset.X = int(math.Floor(position*float64(free.X) + 0.5))
+		}
+	} else if free.Y > 0 {
+		offset.Y = int(math.Floor(position*float64(free.Y) + 0.5))
+	}
+
+	return offset
+}
+
+// Format a zoom level the way it appears in filenames.
+func zoomString(zoom float64) string {
+	return strconv.FormatFloat(zoom, 'f', -1, 64) + "x"
+}
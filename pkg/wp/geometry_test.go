@@ -0,0 +1,94 @@
+package wp
+
+import (
+	"image"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScaleToFill(t *testing.T) {
+	assert.Equal(t, image.Pt(64, 64), scaleToFill(image.Pt(128, 128), image.Pt(64, 64)))
+	assert.Equal(t, image.Pt(128, 64), scaleToFill(image.Pt(256, 128), image.Pt(64, 64)))
+	assert.Equal(t, image.Pt(64, 128), scaleToFill(image.Pt(128, 256), image.Pt(64, 64)))
+	assert.Equal(t, image.Pt(1920, 1081), scaleToFill(image.Pt(3840, 2161), image.Pt(1920, 1080)))
+	assert.Equal(t, image.Pt(256, 256), scaleToFill(image.Pt(128, 128), image.Pt(256, 256)))
+}
+
+func TestScaleToFit(t *testing.T) {
+	assert.Equal(t, image.Pt(64, 64), scaleToFit(image.Pt(128, 128), image.Pt(64, 64)))
+	assert.Equal(t, image.Pt(64, 32), scaleToFit(image.Pt(256, 128), image.Pt(64, 64)))
+	assert.Equal(t, image.Pt(32, 64), scaleToFit(image.Pt(128, 256), image.Pt(256, 64)))
+	assert.Equal(t, image.Pt(1919, 1080), scaleToFit(image.Pt(3840, 2161), image.Pt(1920, 1080)))
+	assert.Equal(t, image.Pt(1, 8), scaleToFit(image.Pt(2, 1000), image.Pt(8, 8)))
+}
+
+func TestUpscaleFactor(t *testing.T) {
+	assert.Equal(t, 0.5, upscaleFactor(image.Pt(128, 128), image.Pt(64, 64)))
+	assert.Equal(t, 0.5, upscaleFactor(image.Pt(256, 128), image.Pt(64, 64)))
+	assert.Equal(t, 1.25, upscaleFactor(image.Pt(256, 128), image.Pt(320, 64)))
+	assert.Equal(t, 2.0, upscaleFactor(image.Pt(64, 64), image.Pt(64, 128)))
+}
+
+func TestGravityOffset(t *testing.T) {
+	outer := image.Pt(5, 4)
+	inner := image.Pt(2, 3)
+
+	expected := map[string]image.Point{
+		"NorthWest": image.Pt(0, 0),
+		"North":     image.Pt(1, 0),
+		"NorthEast": image.Pt(3, 0),
+		"West":      image.Pt(0, 1),
+		"Center":    image.Pt(1, 1),
+		"East":      image.Pt(3, 1),
+		"SouthWest": image.Pt(0, 1),
+		"South":     image.Pt(1, 1),
+		"SouthEast": image.Pt(3, 1),
+		"north":     image.Pt(1, 0),
+	}
+
+	for gravity, point := range expected {
+		offset, err := gravityOffset(gravity, outer, inner)
+		assert.NoError(t, err)
+		assert.Equal(t, point, offset, gravity)
+	}
+}
+
+func TestGravityOffsetUnknown(t *testing.T) {
+	offset, err := gravityOffset("up", image.Pt(5, 4), image.Pt(2, 3))
+	assert.Equal(t, image.ZP, offset)
+	assert.Equal(t, "Unknown gravity (up)", err.Error())
+}
+
+func TestParsePosition(t *testing.T) {
+	for str, expected := range map[string]float64{"0": 0, "1": 1, "0.35": 0.35, "1.0": 1} {
+		position, ok := ParsePosition(str)
+		assert.True(t, ok, str)
+		assert.Equal(t, expected, position)
+	}
+
+	for _, str := range []string{"1.5", "-0.5", ".5", "center", "1e-1", ""} {
+		_, ok := ParsePosition(str)
+		assert.False(t, ok, str)
+	}
+}
+
+func TestStepPositions(t *testing.T) {
+	assert.Equal(t, []string{"0.5"}, stepPositions(1))
+	assert.Equal(t, []string{"0", "1"}, stepPositions(2))
+	assert.Equal(t, []string{"0", "0.3333", "0.6667", "1"}, stepPositions(4))
+	assert.Equal(t, []string{"0", "0.25", "0.5", "0.75", "1"}, stepPositions(5))
+}
+
+func TestPositionOffset(t *testing.T) {
+	assert.Equal(t, image.Pt(0, 0), positionOffset(0, image.Pt(128, 64), image.Pt(64, 64)))
+	assert.Equal(t, image.Pt(22, 0), positionOffset(0.35, image.Pt(128, 64), image.Pt(64, 64)))
+	assert.Equal(t, image.Pt(64, 0), positionOffset(1, image.Pt(128, 64), image.Pt(64, 64)))
+	assert.Equal(t, image.Pt(0, 32), positionOffset(0.5, image.Pt(64, 128), image.Pt(64, 64)))
+
+	// Along the short axis, the slice is centered.
+	assert.Equal(t, image.Pt(60, 10), positionOffset(0.5, image.Pt(184, 84), image.Pt(64, 64)))
+	assert.Equal(t, image.Pt(0, 0), positionOffset(0.5, image.Pt(64, 64), image.Pt(64, 64)))
+}
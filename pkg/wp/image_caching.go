@@ -1,21 +1,30 @@
 package wp
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 type ImageSource struct {
 	SourcePath string
 	LocalPath  string
 
-	deleteParentDir bool
+	// Directory created to hold a source that isn't being cached, which is
+	//   removed along with it.
+	tempDir string
 }
 
 func (is *ImageSource) SourcePathIsLocal() (bool, error) {
@@ -29,6 +38,9 @@ func (is *ImageSource) SourcePathIsLocal() (bool, error) {
 
 // Get the local image path from a given source image.
 // This path will be a relative path that can be put anywhere needed.
+// Remote sources each get a directory of their own, named for a hash of the
+//   whole URL, so that URLs that only differ by their query string, or that
+//   share a file name, don't overwrite one another.
 func (is *ImageSource) GetImagePath() (string, error) {
 	pathUrl, err := url.Parse(is.SourcePath)
 	if err != nil {
@@ -36,36 +48,64 @@ func (is *ImageSource) GetImagePath() (string, error) {
 	}
 
 	if pathUrl.Scheme != "" && pathUrl.Scheme != "file" {
-		return path.Join(pathUrl.Hostname(), filepath.Dir(pathUrl.Path)), nil
+		hash := sha256.Sum256([]byte(is.SourcePath))
+		return path.Join(pathUrl.Hostname(), hex.EncodeToString(hash[:])[:16]), nil
 	}
 
 	return "", nil
 }
 
-type FileDownloader func(destFile, sourceUrl string) error
-
-// Ripped from https://golangcode.com/download-a-file-from-a-url
-var downloadFile FileDownloader = func(destFile, sourceUrl string) error {
-	resp, err := http.Get(sourceUrl)
+// Get the path a remote source was cached at before cache entries were named
+//   for a hash of their URL.
+func (is *ImageSource) legacyImagePath(cacheDir string) (string, error) {
+	pathUrl, err := url.Parse(is.SourcePath)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	out, err := os.Create(destFile)
+	return path.Join(cacheDir, pathUrl.Hostname(), filepath.Dir(pathUrl.Path), path.Base(is.SourcePath)), nil
+}
+
+// Get the name of the file the source is copied or downloaded to.
+// Remote sources are named for the last part of the URL's path, leaving off
+//   any query string, and given an extension once they're downloaded.
+func (is *ImageSource) imageName() (string, error) {
+	pathUrl, err := url.Parse(is.SourcePath)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	if pathUrl.Scheme == "" || pathUrl.Scheme == "file" {
+		return path.Base(is.SourcePath), nil
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
-	return err
+	name := path.Base(pathUrl.Path)
+	if name == "/" || name == "." {
+		return "image", nil
+	}
+
+	return name, nil
+}
+
+// Locks held while a local path is being prepared, so that many sources
+//   being prepared at once can share a cache directory without writing over
+//   one another.
+var localPathLocks sync.Map
+
+func lockLocalPath(localPath string) func() {
+	lock, _ := localPathLocks.LoadOrStore(localPath, &sync.Mutex{})
+	mutex := lock.(*sync.Mutex)
+	mutex.Lock()
+	return mutex.Unlock
 }
 
 // Take the provided source path, and make a temporary copy of it that can be
 //   fed through imagemagick repeatedly.
 // CleaupImageSource must be called for the returned ImageSource.
-func PrepareImageFromSource(sourcePath string, cacheDir string) (*ImageSource, error) {
+// Remote sources are downloaded according to the download options.
+// Cached sources that can't be revalidated are still prepared, and returned
+//   along with an error saying so.
+func PrepareImageFromSource(sourcePath string, cacheDir string, opts DownloadOptions) (*ImageSource, error) {
 	is := ImageSource{}
 	is.SourcePath = sourcePath
 
@@ -96,7 +136,6 @@ func PrepareImageFromSource(sourcePath string, cacheDir string) (*ImageSource, e
 				}
 
 				is.LocalPath = is.SourcePath
-				is.deleteParentDir = false
 				return &is, nil
 			}
 		}
@@ -110,10 +149,9 @@ func PrepareImageFromSource(sourcePath string, cacheDir string) (*ImageSource, e
 		}
 
 		outputDir = tempDir
-		is.deleteParentDir = true
+		is.tempDir = tempDir
 	} else {
 		outputDir = cacheDir
-		is.deleteParentDir = false
 	}
 
 	extraPath, err := is.GetImagePath()
@@ -121,50 +159,366 @@ func PrepareImageFromSource(sourcePath string, cacheDir string) (*ImageSource, e
 		return nil, err
 	}
 
-	is.LocalPath = path.Join(outputDir, extraPath, path.Base(is.SourcePath))
+	name, err := is.imageName()
+	if err != nil {
+		return nil, err
+	}
+
+	entryDir := path.Join(outputDir, extraPath)
+	is.LocalPath = path.Join(entryDir, name)
+
+	unlock := lockLocalPath(is.LocalPath)
+	defer unlock()
 
-	err = os.MkdirAll(filepath.Dir(is.LocalPath), 0755)
+	err = os.MkdirAll(entryDir, 0755)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err = os.Stat(is.LocalPath); err != nil && !os.IsNotExist(err) {
+	isLocal, err := is.SourcePathIsLocal()
+	if err != nil {
 		return nil, err
 	}
 
+	// Downloads are named for what they turn out to be, so whatever image is
+	//   in the source's directory is the one that was cached for it.
+	// Images cached with the old layout are moved into the new one.
+	if !isLocal {
+		cachedPath, err := cachedImagePath(entryDir)
+		if err != nil {
+			return nil, err
+		}
+
+		if cachedPath == "" && cacheDir != "" {
+			cachedPath = is.migrateLegacyImage(cacheDir, entryDir)
+		}
+
+		if cachedPath != "" {
+			is.LocalPath = cachedPath
+		}
+	}
+
+	info, err := os.Stat(is.LocalPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Downloads are used as they are unless they need to be revalidated.
+	var previous DownloadMetadata
+	cached := false
 	if err == nil {
-		return &is, nil
+		previous, cached = cachedImageValid(is.LocalPath, info)
+		if !cached {
+			if err := os.Remove(is.LocalPath); err != nil {
+				return nil, err
+			}
+		} else if isLocal || opts.Offline || !opts.stale(previous) {
+			return &is, nil
+		}
 	}
 
-	pathUrl, err := url.Parse(is.SourcePath)
+	if !isLocal && opts.Offline {
+		return &is, errors.New(fmt.Sprintf("Image (%s) isn't cached, so can't be used offline", is.SourcePath))
+	}
+
+	localPath, metadata, err := fetchSource(is.LocalPath, is.SourcePath, opts, previous)
+	if err == errNotModified {
+		metadata = previous
+		metadata.FetchedAt = time.Now()
+	} else if _, ok := err.(transientError); ok && cached {
+		// The host couldn't be asked whether the source has changed, but the
+		//   cached copy is still a usable image, so it's used as it is.
+		return &is, errors.New(fmt.Sprintf("Image (%s) couldn't be revalidated, so its cached copy was used (%s)", is.SourcePath, err))
+	} else if err != nil {
+		return &is, err
+	} else if localPath != is.LocalPath {
+		// The source changed to a different format, so the image it replaces
+		//   has a different name.
+		os.Remove(is.LocalPath)
+		os.Remove(metadataPath(is.LocalPath))
+		is.LocalPath = localPath
+	}
+
+	if cacheDir != "" {
+		return &is, writeMetadata(is.LocalPath, metadata)
+	}
+
+	return &is, nil
+}
+
+// Check whether the cached image, and its metadata, can be used.
+// Images are checked for being whole when they're written, and their size
+//   recorded, so later uses only need to check that the size hasn't changed.
+// Images cached before sizes were recorded may have been cut short, so they
+//   have to be checked, once, before their size is recorded.
+func cachedImageValid(localPath string, info os.FileInfo) (DownloadMetadata, bool) {
+	metadata := readMetadata(localPath)
+	if metadata.Size != 0 {
+		return metadata, metadata.Size == info.Size()
+	}
+
+	if validateImage(localPath) != nil {
+		return metadata, false
+	}
+
+	metadata.Size = info.Size()
+	writeMetadata(localPath, metadata)
+	return metadata, true
+}
+
+// Get the path of the image cached in a remote source's directory, or an
+//   empty string if there isn't one.
+// Temporary files and metadata are hidden, so are never mistaken for it.
+func cachedImagePath(entryDir string) (string, error) {
+	files, err := ioutil.ReadDir(entryDir)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	if pathUrl.Scheme == "file" || pathUrl.Scheme == "" {
-		source, err := os.Open(pathUrl.Path)
-		if err != nil {
-			return nil, err
+	for _, file := range files {
+		if file.Mode().IsRegular() && !strings.HasPrefix(file.Name(), ".") {
+			return path.Join(entryDir, file.Name()), nil
 		}
-		defer source.Close()
+	}
 
-		destination, err := os.Create(is.LocalPath)
-		if err != nil {
-			return nil, err
+	return "", nil
+}
+
+// Move the source's image from where it was cached before cache entries were
+//   named for a hash of their URL into its directory, and get its new path.
+// Images whose metadata says they were downloaded from a different URL, or
+//   that don't decode, are left where they are, and an empty string returned.
+func (is *ImageSource) migrateLegacyImage(cacheDir string, entryDir string) string {
+	legacyPath, err := is.legacyImagePath(cacheDir)
+	if err != nil {
+		return ""
+	}
+
+	if info, err := os.Stat(legacyPath); err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+
+	metadata := readMetadata(legacyPath)
+	if metadata.URL != "" && metadata.URL != is.SourcePath {
+		return ""
+	}
+
+	info, err := os.Stat(legacyPath)
+	if err != nil || validateImage(legacyPath) != nil {
+		return ""
+	}
+
+	name, err := is.imageName()
+	if err != nil {
+		return ""
+	}
+
+	localPath := path.Join(entryDir, cachedImageName(name, sniffImageFile(legacyPath)))
+	if err := os.Rename(legacyPath, localPath); err != nil {
+		return ""
+	}
+
+	os.Remove(metadataPath(legacyPath))
+	metadata.Size = info.Size()
+	writeMetadata(localPath, metadata)
+	return localPath
+}
+
+// Get the name a downloaded image is cached with; the name from its URL,
+//   with an extension that matches the format it's actually in.
+// Names that already have a fitting extension are left alone.
+func cachedImageName(name string, format string) string {
+	extensions := imageFormatExtensions[format]
+	if len(extensions) == 0 {
+		return name
+	}
+
+	extension := path.Ext(name)
+	for _, e := range extensions {
+		if strings.ToLower(extension) == e {
+			return name
 		}
-		defer destination.Close()
+	}
+
+	stem := strings.TrimSuffix(name, extension)
+	if stem == "" {
+		stem = "image"
+	}
+
+	return stem + extensions[0]
+}
+
+// Check whether a download fetched with the given metadata needs to be
+//   revalidated before it's used.
+func (o DownloadOptions) stale(metadata DownloadMetadata) bool {
+	return o.Revalidate || (o.MaxAge > 0 && time.Since(metadata.FetchedAt) > o.MaxAge)
+}
+
+// Get the path of the file holding the metadata of a cached download.
+func metadataPath(localPath string) string {
+	return path.Join(path.Dir(localPath), "."+path.Base(localPath)+".json")
+}
+
+// Read the metadata of a cached download.
+// Downloads cached without any metadata are treated as if nothing is known
+//   about them, so are fetched again whenever they're revalidated.
+func readMetadata(localPath string) DownloadMetadata {
+	var metadata DownloadMetadata
+
+	contents, err := ioutil.ReadFile(metadataPath(localPath))
+	if err != nil {
+		return metadata
+	}
+
+	if err := json.Unmarshal(contents, &metadata); err != nil {
+		return DownloadMetadata{}
+	}
+
+	return metadata
+}
+
+func writeMetadata(localPath string, metadata DownloadMetadata) error {
+	contents, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(metadataPath(localPath), contents, 0644)
+}
 
-		_, err = io.Copy(destination, source)
+// Copy or download the source to destFile, and get the path it was written
+//   to.
+// The source is written to a temporary file next to destFile, which is only
+//   moved into place once it's complete, so an interrupted fetch never
+//   leaves a partial image where it'll be mistaken for a cached one.
+// Downloads are given an extension that matches their format, so may not be
+//   written to destFile exactly.
+// Downloads that were fetched before are conditional on the source having
+//   changed since, and leave destFile alone if it hasn't.
+// Downloads are checked for being whole, and local sources for being
+//   measurable, before they're moved into place, and their size is recorded
+//   in the returned metadata.
+func fetchSource(destFile string, sourcePath string, opts DownloadOptions, previous DownloadMetadata) (string, DownloadMetadata, error) {
+	var metadata DownloadMetadata
+	pathUrl, err := url.Parse(sourcePath)
+	if err != nil {
+		return "", metadata, err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(destFile), "."+path.Base(destFile)+".*")
+	if err != nil {
+		return "", metadata, err
+	}
+
+	tempPath := temp.Name()
+	temp.Close()
+
+	// Local sources are only measured, rather than decoded, since they can't
+	//   have been cut short on the way, and can be very large.
+	validate := validateImage
+	if pathUrl.Scheme == "file" || pathUrl.Scheme == "" {
+		err = copyFile(tempPath, pathUrl.Path)
+		validate = checkImageLength
 	} else {
-		err = downloadFile(is.LocalPath, is.SourcePath)
+		metadata, err = downloadFile(tempPath, sourcePath, opts, previous)
+		destFile = path.Join(filepath.Dir(destFile), cachedImageName(path.Base(destFile), sniffImageFile(tempPath)))
+	}
+
+	if err == nil {
+		if validateErr := validate(tempPath); validateErr != nil {
+			err = errors.New(fmt.Sprintf("Image (%s) is incomplete or corrupt (%s)", sourcePath, validateErr))
+		}
+	}
+
+	if err == nil {
+		err = os.Chmod(tempPath, 0644)
+	}
+
+	var info os.FileInfo
+	if err == nil {
+		info, err = os.Stat(tempPath)
+	}
+
+	if err == nil {
+		metadata.Size = info.Size()
+		err = os.Rename(tempPath, destFile)
 	}
 
-	return &is, err
+	if err != nil {
+		os.Remove(tempPath)
+		return "", metadata, err
+	}
+
+	return destFile, metadata, nil
+}
+
+func copyFile(destFile string, sourceFile string) error {
+	source, err := os.Open(sourceFile)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.Create(destFile)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(destination, source); err != nil {
+		destination.Close()
+		return err
+	}
+
+	return destination.Close()
+}
+
+// Check that the image at the path is whole, by decoding it.
+// Images in formats that can't be decoded in-process are measured, and
+//   checked against the length their container says they should be.
+func validateImage(imagePath string) error {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, _, err := image.Decode(f); err != image.ErrFormat {
+		return err
+	}
+
+	return checkImageLength(imagePath)
+}
+
+// Check that the image at the path can be measured, and is as long as its
+//   container says it should be, without decoding it.
+func checkImageLength(imagePath string) error {
+	if _, err := GetImageDimensions(imagePath); err != nil {
+		return err
+	}
+
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if truncatedImage(f, info.Size()) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
 }
 
 func CleanupImageSource(is *ImageSource) error {
-	if is.deleteParentDir {
-		return os.RemoveAll(path.Dir(is.LocalPath))
+	forgetSaliency(is.LocalPath)
+
+	if is.tempDir != "" {
+		return os.RemoveAll(is.tempDir)
 	}
 
 	return nil
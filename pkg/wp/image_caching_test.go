@@ -1,11 +1,18 @@
 package wp
 
 import (
+	"errors"
+	"image"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 import (
@@ -17,7 +24,7 @@ func TestPrepareImageFromSourceLocal(t *testing.T) {
 	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
 	assert.NoError(t, err)
 
-	is, err := PrepareImageFromSource(sourceImage, "")
+	is, err := PrepareImageFromSource(sourceImage, "", DownloadOptions{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, "square.jpg", path.Base(is.LocalPath))
@@ -33,7 +40,7 @@ func TestPrepareImageFromSourceLocalCached(t *testing.T) {
 	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
 	assert.NoError(t, err)
 
-	is, err := PrepareImageFromSource(sourceImage, tempDir)
+	is, err := PrepareImageFromSource(sourceImage, tempDir, DownloadOptions{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, "square.jpg", path.Base(is.LocalPath))
@@ -50,7 +57,7 @@ func TestPrepareImageFromSourceLocalCachedInCacheDir(t *testing.T) {
 	sourceImage, err := filepath.Abs(path.Join(projectRoot, "test_images", "square.jpg"))
 	assert.NoError(t, err)
 
-	is, err := PrepareImageFromSource(sourceImage, projectRoot)
+	is, err := PrepareImageFromSource(sourceImage, projectRoot, DownloadOptions{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, is.SourcePath, is.LocalPath)
@@ -65,7 +72,7 @@ func TestPrepareImageFromSourceLocalWithProtocol(t *testing.T) {
 	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
 	assert.NoError(t, err)
 
-	is, err := PrepareImageFromSource("file://"+sourceImage, "")
+	is, err := PrepareImageFromSource("file://"+sourceImage, "", DownloadOptions{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, "square.jpg", path.Base(is.LocalPath))
@@ -82,16 +89,16 @@ func TestPrepareImageFromSourceRemote(t *testing.T) {
 	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
 	assert.NoError(t, err)
 
-	downloadFile = func(dest, url string) error {
+	downloadFile = func(dest, url string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error) {
 		input, err := ioutil.ReadFile(sourceImage)
 		assert.NoError(t, err)
 
 		err = ioutil.WriteFile(dest, input, 0644)
 		assert.NoError(t, err)
-		return nil
+		return DownloadMetadata{}, nil
 	}
 
-	is, err := PrepareImageFromSource("http://"+sourceImage, "")
+	is, err := PrepareImageFromSource("http://"+sourceImage, "", DownloadOptions{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, "square.jpg", path.Base(is.LocalPath))
@@ -103,7 +110,7 @@ func TestCleanupImageSource(t *testing.T) {
 	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
 	assert.NoError(t, err)
 
-	is, err := PrepareImageFromSource(sourceImage, "")
+	is, err := PrepareImageFromSource(sourceImage, "", DownloadOptions{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, "square.jpg", path.Base(is.LocalPath))
@@ -116,3 +123,495 @@ func TestCleanupImageSource(t *testing.T) {
 	assert.NotNil(t, e)
 	assert.True(t, os.IsNotExist(e))
 }
+
+func TestPrepareImageFromSourceRemoteCachedConcurrently(t *testing.T) {
+	g := downloadFile
+	defer func() {
+		downloadFile = g
+	}()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	var mutex sync.Mutex
+	downloads := 0
+	downloadFile = func(dest, url string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error) {
+		mutex.Lock()
+		downloads++
+		mutex.Unlock()
+
+		input, err := ioutil.ReadFile(sourceImage)
+		assert.NoError(t, err)
+
+		return DownloadMetadata{}, ioutil.WriteFile(dest, input, 0644)
+	}
+
+	RunJobs(4, 8, func(i int) {
+		is, err := PrepareImageFromSource("http://example.com/square.jpg", tempDir, DownloadOptions{})
+		assert.NoError(t, err)
+		CleanupImageSource(is)
+	})
+
+	assert.Equal(t, 1, downloads)
+}
+
+func TestPrepareImageFromSourceRemoteFailureNotCached(t *testing.T) {
+	g := downloadFile
+	defer func() {
+		downloadFile = g
+	}()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Write part of an image before failing, like a dropped connection.
+	downloadFile = func(dest, url string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error) {
+		assert.NoError(t, ioutil.WriteFile(dest, []byte{0xff, 0xd8, 0xff, 0xe0}, 0644))
+		return DownloadMetadata{}, errors.New("connection reset by peer")
+	}
+
+	is, err := PrepareImageFromSource("http://example.com/square.jpg", tempDir, DownloadOptions{})
+	assert.Equal(t, "connection reset by peer", err.Error())
+
+	_, err = os.Stat(is.LocalPath)
+	assert.True(t, os.IsNotExist(err))
+
+	// Nothing is left behind in the cache at all.
+	files := 0
+	err = filepath.Walk(tempDir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files++
+		}
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, files)
+}
+
+func TestPrepareImageFromSourceRemoteCachedTruncated(t *testing.T) {
+	g := downloadFile
+	defer func() {
+		downloadFile = g
+	}()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	input, err := ioutil.ReadFile(sourceImage)
+	assert.NoError(t, err)
+
+	// A cached image cut short by an interrupted download.
+	source := ImageSource{SourcePath: "http://example.com/square.jpg"}
+	entryDir, err := source.GetImagePath()
+	assert.NoError(t, err)
+
+	cachedImage := path.Join(tempDir, entryDir, "square.jpg")
+	assert.NoError(t, os.MkdirAll(path.Dir(cachedImage), 0755))
+	assert.NoError(t, ioutil.WriteFile(cachedImage, input[:len(input)/2], 0644))
+
+	downloads := 0
+	downloadFile = func(dest, url string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error) {
+		downloads++
+		return DownloadMetadata{}, ioutil.WriteFile(dest, input, 0644)
+	}
+
+	for i := 0; i < 2; i++ {
+		is, err := PrepareImageFromSource("http://example.com/square.jpg", tempDir, DownloadOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, cachedImage, is.LocalPath)
+	}
+
+	assert.Equal(t, 1, downloads)
+
+	cached, err := ioutil.ReadFile(cachedImage)
+	assert.NoError(t, err)
+	assert.Equal(t, input, cached)
+}
+
+func TestPrepareImageFromSourceRevalidate(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cwd, _ := os.Getwd()
+	version := "square"
+	var conditions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditions = append(conditions, r.Header.Get("If-None-Match"))
+
+		etag := `"` + version + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		contents, err := ioutil.ReadFile(path.Join(cwd, "..", "..", "test_images", version+".jpg"))
+		assert.NoError(t, err)
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(contents)
+	}))
+	defer server.Close()
+
+	var localPath string
+	prepare := func(opts DownloadOptions) image.Point {
+		is, err := PrepareImageFromSource(server.URL+"/image.jpg", tempDir, opts)
+		assert.NoError(t, err)
+		localPath = is.LocalPath
+
+		size, err := GetImageDimensions(is.LocalPath)
+		assert.NoError(t, err)
+		return size
+	}
+
+	assert.Equal(t, image.Pt(128, 128), prepare(DownloadOptions{}))
+	assert.Equal(t, []string{""}, conditions)
+
+	metadata := readMetadata(localPath)
+	assert.Equal(t, server.URL+"/image.jpg", metadata.URL)
+	assert.Equal(t, `"square"`, metadata.ETag)
+
+	// Cached images are used as they are, unless asked to revalidate them.
+	version = "wide"
+	assert.Equal(t, image.Pt(128, 128), prepare(DownloadOptions{}))
+	assert.Equal(t, 1, len(conditions))
+
+	assert.Equal(t, image.Pt(256, 128), prepare(DownloadOptions{Revalidate: true}))
+	assert.Equal(t, []string{"", `"square"`}, conditions)
+
+	assert.Equal(t, image.Pt(256, 128), prepare(DownloadOptions{Revalidate: true}))
+	assert.Equal(t, []string{"", `"square"`, `"wide"`}, conditions)
+
+	// Images only need revalidating once they're older than the maximum age.
+	assert.Equal(t, image.Pt(256, 128), prepare(DownloadOptions{MaxAge: time.Hour}))
+	assert.Equal(t, 3, len(conditions))
+
+	metadata = readMetadata(localPath)
+	metadata.FetchedAt = metadata.FetchedAt.Add(-2 * time.Hour)
+	assert.NoError(t, writeMetadata(localPath, metadata))
+
+	assert.Equal(t, image.Pt(256, 128), prepare(DownloadOptions{MaxAge: time.Hour}))
+	assert.Equal(t, 4, len(conditions))
+
+	// Offline, only the cache is used, however old it is.
+	assert.Equal(t, image.Pt(256, 128), prepare(DownloadOptions{Revalidate: true, Offline: true}))
+	assert.Equal(t, 4, len(conditions))
+}
+
+func TestPrepareImageFromSourceOffline(t *testing.T) {
+	g := downloadFile
+	defer func() {
+		downloadFile = g
+	}()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	downloadFile = func(dest, url string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error) {
+		assert.Fail(t, "Downloaded while offline")
+		return DownloadMetadata{}, nil
+	}
+
+	_, err = PrepareImageFromSource("http://example.com/square.jpg", tempDir, DownloadOptions{Offline: true})
+	assert.Equal(t, "Image (http://example.com/square.jpg) isn't cached, so can't be used offline", err.Error())
+
+	// Local images don't need downloading, so can still be used.
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	is, err := PrepareImageFromSource(sourceImage, tempDir, DownloadOptions{Offline: true})
+	assert.NoError(t, err)
+	CleanupImageSource(is)
+}
+
+func TestGetImagePath(t *testing.T) {
+	imagePath := func(sourcePath string) string {
+		is := ImageSource{SourcePath: sourcePath}
+		p, err := is.GetImagePath()
+		assert.NoError(t, err)
+		return p
+	}
+
+	assert.Equal(t, "", imagePath("/images/square.jpg"))
+	assert.Equal(t, "", imagePath("file:///images/square.jpg"))
+
+	p := imagePath("http://example.com/image?id=1")
+	assert.Equal(t, "example.com", path.Dir(p))
+	assert.Equal(t, p, imagePath("http://example.com/image?id=1"))
+	assert.NotEqual(t, p, imagePath("http://example.com/image?id=2"))
+	assert.NotEqual(t, imagePath("http://example.com/a/square.jpg"), imagePath("http://example.com/b/square.jpg"))
+}
+
+func TestCachedImageName(t *testing.T) {
+	assert.Equal(t, "square.jpg", cachedImageName("square.jpg", "jpeg"))
+	assert.Equal(t, "square.JPEG", cachedImageName("square.JPEG", "jpeg"))
+	assert.Equal(t, "12345.jpg", cachedImageName("12345", "jpeg"))
+	assert.Equal(t, "square.png", cachedImageName("square.jpg", "png"))
+	assert.Equal(t, "scan.tif", cachedImageName("scan.tif", "tiff"))
+	assert.Equal(t, "photo.heif", cachedImageName("photo.heif", "heic"))
+	assert.Equal(t, "image.webp", cachedImageName(".jpg", "webp"))
+	assert.Equal(t, "square.jpg", cachedImageName("square.jpg", ""))
+}
+
+func TestPrepareImageFromSourceRemoteQueryStrings(t *testing.T) {
+	g := downloadFile
+	defer func() {
+		downloadFile = g
+	}()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cwd, _ := os.Getwd()
+	downloadFile = func(dest, url string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error) {
+		name := "square.jpg"
+		if strings.HasSuffix(url, "2") {
+			name = "wide.jpg"
+		}
+
+		input, err := ioutil.ReadFile(path.Join(cwd, "..", "..", "test_images", name))
+		assert.NoError(t, err)
+
+		return DownloadMetadata{URL: url}, ioutil.WriteFile(dest, input, 0644)
+	}
+
+	square, err := PrepareImageFromSource("http://example.com/image.jpg?id=1", tempDir, DownloadOptions{})
+	assert.NoError(t, err)
+
+	wide, err := PrepareImageFromSource("http://example.com/image.jpg?id=2", tempDir, DownloadOptions{})
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, square.LocalPath, wide.LocalPath)
+	assert.Equal(t, "image.jpg", path.Base(square.LocalPath))
+	assert.Equal(t, "image.jpg", path.Base(wide.LocalPath))
+
+	size, err := GetImageDimensions(square.LocalPath)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(128, 128), size)
+
+	size, err = GetImageDimensions(wide.LocalPath)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(256, 128), size)
+}
+
+func TestPrepareImageFromSourceRemoteNoExtension(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		serveSquare(t, w, "application/octet-stream")
+	}))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		is, err := PrepareImageFromSource(server.URL+"/image/12345", tempDir, DownloadOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "12345.jpg", path.Base(is.LocalPath))
+	}
+
+	assert.Equal(t, 1, requests)
+
+	is, err := PrepareImageFromSource(server.URL+"/", tempDir, DownloadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "image.jpg", path.Base(is.LocalPath))
+}
+
+func TestPrepareImageFromSourceLegacyCache(t *testing.T) {
+	g := downloadFile
+	defer func() {
+		downloadFile = g
+	}()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cwd, _ := os.Getwd()
+	input, err := ioutil.ReadFile(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	downloads := 0
+	downloadFile = func(dest, url string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error) {
+		downloads++
+		return DownloadMetadata{URL: url}, ioutil.WriteFile(dest, input, 0644)
+	}
+
+	// Images cached under their host and path are moved, not downloaded again.
+	legacyImage := path.Join(tempDir, "example.com", "photos", "square.jpg")
+	assert.NoError(t, os.MkdirAll(path.Dir(legacyImage), 0755))
+	assert.NoError(t, ioutil.WriteFile(legacyImage, input, 0644))
+	assert.NoError(t, writeMetadata(legacyImage, DownloadMetadata{URL: "http://example.com/photos/square.jpg", ETag: `"square"`}))
+
+	is, err := PrepareImageFromSource("http://example.com/photos/square.jpg", tempDir, DownloadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, downloads)
+	assert.NotEqual(t, legacyImage, is.LocalPath)
+	assert.Equal(t, `"square"`, readMetadata(is.LocalPath).ETag)
+
+	_, err = os.Stat(legacyImage)
+	assert.True(t, os.IsNotExist(err))
+
+	// Ones that were downloaded from another URL are left alone.
+	legacyImage = path.Join(tempDir, "example.com", "photos", "other.jpg")
+	assert.NoError(t, ioutil.WriteFile(legacyImage, input, 0644))
+	assert.NoError(t, writeMetadata(legacyImage, DownloadMetadata{URL: "https://example.com/photos/other.jpg"}))
+
+	is, err = PrepareImageFromSource("http://example.com/photos/other.jpg", tempDir, DownloadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, downloads)
+
+	_, err = os.Stat(legacyImage)
+	assert.NoError(t, err)
+}
+
+func TestPrepareImageFromSourceCachedSize(t *testing.T) {
+	g := downloadFile
+	defer func() {
+		downloadFile = g
+	}()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cwd, _ := os.Getwd()
+	input, err := ioutil.ReadFile(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	downloads := 0
+	downloadFile = func(dest, url string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error) {
+		downloads++
+		return DownloadMetadata{URL: url}, ioutil.WriteFile(dest, input, 0644)
+	}
+
+	is, err := PrepareImageFromSource("http://example.com/square.jpg", tempDir, DownloadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(input)), readMetadata(is.LocalPath).Size)
+
+	// Cached images are trusted as long as they're the size they were
+	//   written at, without being decoded again.
+	assert.NoError(t, ioutil.WriteFile(is.LocalPath, make([]byte, len(input)), 0644))
+	_, err = PrepareImageFromSource("http://example.com/square.jpg", tempDir, DownloadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, downloads)
+
+	assert.NoError(t, ioutil.WriteFile(is.LocalPath, input[:len(input)/2], 0644))
+	_, err = PrepareImageFromSource("http://example.com/square.jpg", tempDir, DownloadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, downloads)
+
+	cached, err := ioutil.ReadFile(is.LocalPath)
+	assert.NoError(t, err)
+	assert.Equal(t, input, cached)
+}
+
+func TestPrepareImageFromSourceRemoteIncomplete(t *testing.T) {
+	g := downloadFile
+	defer func() {
+		downloadFile = g
+	}()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cwd, _ := os.Getwd()
+	input, err := ioutil.ReadFile(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	downloadFile = func(dest, url string, opts DownloadOptions, previous DownloadMetadata) (DownloadMetadata, error) {
+		return DownloadMetadata{URL: url}, ioutil.WriteFile(dest, input[:len(input)/2], 0644)
+	}
+
+	is, err := PrepareImageFromSource("http://example.com/square.jpg", tempDir, DownloadOptions{})
+	assert.Equal(t, "Image (http://example.com/square.jpg) is incomplete or corrupt (unexpected EOF)", err.Error())
+
+	_, err = os.Stat(is.LocalPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPrepareImageFromSourceLocalMeasured(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	cwd, _ := os.Getwd()
+	input, err := ioutil.ReadFile(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	// Local sources are only measured, so aren't decoded to be copied.
+	sourceImage := path.Join(tempDir, "square.jpg")
+	assert.NoError(t, ioutil.WriteFile(sourceImage, input[:len(input)-64], 0644))
+
+	is, err := PrepareImageFromSource(sourceImage, "", DownloadOptions{})
+	assert.NoError(t, err)
+	defer CleanupImageSource(is)
+
+	_, err = os.Stat(is.LocalPath)
+	assert.NoError(t, err)
+
+	notImage := path.Join(tempDir, "notes.jpg")
+	assert.NoError(t, ioutil.WriteFile(notImage, []byte("not an image"), 0644))
+
+	is, err = PrepareImageFromSource(notImage, "", DownloadOptions{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Image ("+notImage+") is incomplete or corrupt")
+	CleanupImageSource(is)
+}
+
+func TestPrepareImageFromSourceRevalidateUnavailable(t *testing.T) {
+	defer mockRetryDelay()()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		w.Header().Set("ETag", `"square"`)
+		serveSquare(t, w, "image/jpeg")
+	}))
+	defer server.Close()
+
+	is, err := PrepareImageFromSource(server.URL+"/image.jpg", tempDir, DownloadOptions{})
+	assert.NoError(t, err)
+	cachedPath := is.LocalPath
+
+	// Hosts that can't be reached leave the cached copy to be used.
+	status = http.StatusServiceUnavailable
+	is, err = PrepareImageFromSource(server.URL+"/image.jpg", tempDir, DownloadOptions{Revalidate: true, Retries: 1})
+	assert.Equal(t, "Image ("+server.URL+"/image.jpg) couldn't be revalidated, so its cached copy was used (Download of ("+server.URL+"/image.jpg) failed with status (503 Service Unavailable))", err.Error())
+	assert.Equal(t, cachedPath, is.LocalPath)
+
+	size, err := GetImageDimensions(is.LocalPath)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(128, 128), size)
+
+	// Ones that say the source is gone don't.
+	status = http.StatusNotFound
+	_, err = PrepareImageFromSource(server.URL+"/image.jpg", tempDir, DownloadOptions{Revalidate: true})
+	assert.Equal(t, "Download of ("+server.URL+"/image.jpg) failed with status (404 Not Found)", err.Error())
+}
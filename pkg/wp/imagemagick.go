@@ -0,0 +1,256 @@
+package wp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Renders slices by running an ImageMagick style command line tool.
+// ImageMagick 6 and ImageMagick 7 accept the same options, and only differ in
+//   the command that's run.
+type imageMagickRenderer struct {
+	command []string
+}
+
+// GraphicsMagick accepts the same options as ImageMagick when producing a
+//   single slice, but has no support for parentheses, so can't produce many
+//   slices in one invocation.
+type graphicsMagickRenderer struct {
+	renderer imageMagickRenderer
+}
+
+// ImageMagick's names for each filter other than box, which is done with
+//   `-scale`, rather than `-resize`.
+var imageMagickFilters map[string]string = map[string]string{
+	FilterTriangle:   "Triangle",
+	FilterCatmullRom: "Catrom",
+	FilterMitchell:   "Mitchell",
+	FilterLanczos:    "Lanczos",
+}
+
+func dimensionsString(req RenderRequest) string {
+	return fmt.Sprintf("%dx%d", req.Size.X, req.Size.Y)
+}
+
+// Get the arguments that scale the source so that it covers the requested
+//   size, and sharpen it afterwards if needed.
+func scaleArgs(req RenderRequest) []string {
+	scaleSize := req.scaleSize()
+	return resizeArgs(req, fmt.Sprintf("%dx%d^", scaleSize.X, scaleSize.Y))
+}
+
+// Get the arguments that scale the source so that it fits within the
+//   requested size, and sharpen it afterwards if needed.
+func fitArgs(req RenderRequest) []string {
+	return resizeArgs(req, dimensionsString(req))
+}
+
+// Get the arguments that resize the source to the given geometry with the
+//   request's filter, and sharpen it afterwards if needed.
+func resizeArgs(req RenderRequest, dimensions string) []string {
+	var args []string
+	if filter, ok := imageMagickFilters[req.Filter]; ok {
+		args = []string{"-filter", filter, "-resize", dimensions}
+	} else {
+		args = []string{"-scale", dimensions}
+	}
+
+	if req.Sharpen > 0 {
+		args = append(args, "-unsharp", fmt.Sprintf("0x%g+%g+0", sharpenSigma, req.Sharpen))
+	}
+
+	return args
+}
+
+// Get the gravity and geometry passed to `-extent` to cut out the slice.
+// Slices placed at an offset are cut relative to the top left corner; a
+//   negative offset pads the slice, like a gravity would.
+func extentGeometry(req RenderRequest) (string, string) {
+	if req.Gravity == "" {
+		return "NorthWest", fmt.Sprintf("%s%+d%+d", dimensionsString(req), req.Offset.X, req.Offset.Y)
+	}
+
+	return req.Gravity, dimensionsString(req)
+}
+
+// Get the arguments that control how the slice is encoded.
+// PNG is lossless, so only has a compression level, while every other format
+//   only has a quality.
+func outputArgs(req RenderRequest) []string {
+	if formatOfPath(req.OutputPath) == FormatPNG {
+		if req.Compression > 0 {
+			return []string{"-define", fmt.Sprintf("png:compression-level=%d", req.Compression)}
+		}
+	} else if req.Quality > 0 {
+		return []string{"-quality", fmt.Sprintf("%d", req.Quality)}
+	}
+
+	return nil
+}
+
+// Get the arguments that load the request's source.
+// The source is auto-oriented first, so that slices are cut from the image
+//   as it's displayed, rather than as it's stored, and then transformed.
+func sourceArgs(req RenderRequest) []string {
+	args := []string{req.SourcePath, "-auto-orient"}
+	if req.Rotate != 0 {
+		args = append(args, "-rotate", strconv.Itoa(req.Rotate))
+	}
+
+	switch req.Flip {
+	case FlipHorizontal:
+		args = append(args, "-flop")
+	case FlipVertical:
+		args = append(args, "-flip")
+	}
+
+	return args
+}
+
+// Get the arguments to pass to the tool to produce the requested slice.
+func (r *imageMagickRenderer) args(req RenderRequest) []string {
+	gravity, geometry := extentGeometry(req)
+
+	args := append([]string{}, r.command[1:]...)
+	args = append(args, sourceArgs(req)...)
+	args = append(args, "-gravity", gravity)
+
+	if req.Scaled {
+		args = append(args, scaleArgs(req)...)
+	}
+
+	args = append(args, "-extent", geometry)
+	args = append(args, outputArgs(req)...)
+	return append(args, req.OutputPath)
+}
+
+// Get the arguments to pass to the tool to produce a contained slice.
+// Edge fills are made by distorting the scaled source onto a larger canvas,
+//   which lets the source's edges extend across the rest of it, and blur
+//   fills by compositing the scaled source onto a blurred copy of itself.
+func (r *imageMagickRenderer) containArgs(req RenderRequest) ([]string, error) {
+	dimensions := dimensionsString(req)
+
+	args := append([]string{}, r.command[1:]...)
+	args = append(args, sourceArgs(req)...)
+
+	switch req.Fill {
+	case FillEdge:
+		sourceSize, err := req.sourceSize()
+		if err != nil {
+			return nil, err
+		}
+
+		offset, err := req.containOffset(scaleToFit(sourceSize, req.Size))
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, fitArgs(req)...)
+		args = append(args,
+			"-set", "option:distort:viewport", fmt.Sprintf("%s%+d%+d", dimensions, -offset.X, -offset.Y),
+			"-virtual-pixel", "edge", "-filter", "Point", "-distort", "SRT", "0", "+repage",
+		)
+	case FillBlur:
+		args = append(args,
+			"(", "-clone", "0", "-scale", dimensions+"^", "-gravity", "Center", "-extent", dimensions,
+			"-blur", fmt.Sprintf("0x%g", fillBlurSigma),
+			"-fill", "black", "-colorize", fmt.Sprintf("%g%%", 100-fillBlurDarken*100), ")",
+			"(", "-clone", "0",
+		)
+		args = append(args, fitArgs(req)...)
+		args = append(args, ")", "-delete", "0", "-gravity", req.Gravity, "-composite")
+	default:
+		c := req.fillColor()
+		args = append(args, fitArgs(req)...)
+		args = append(args, "-background", fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B), "-gravity", req.Gravity, "-extent", dimensions)
+	}
+
+	args = append(args, outputArgs(req)...)
+	return append(args, req.OutputPath), nil
+}
+
+// Get the arguments to pass to the tool to produce all of the requested
+//   slices from a single load of the source.
+// Each slice is cut from a clone of the source (or of a scaled copy of the
+//   source), written, and then discarded, so the source is only decoded, and
+//   each scale only computed, once.
+func (r *imageMagickRenderer) batchArgs(reqs []RenderRequest) []string {
+	crop := func(req RenderRequest) []string {
+		gravity, geometry := extentGeometry(req)
+		args := []string{"(", "+clone", "-gravity", gravity, "-extent", geometry}
+		args = append(args, outputArgs(req)...)
+		return append(args, "-write", req.OutputPath, "+delete", ")")
+	}
+
+	args := append([]string{}, r.command[1:]...)
+	args = append(args, sourceArgs(reqs[0])...)
+
+	unscaled, scaled := partitionRequests(reqs)
+	for _, group := range scaled {
+		args = append(args, "(", "+clone")
+		args = append(args, scaleArgs(group[0])...)
+		for _, req := range group {
+			args = append(args, crop(req)...)
+		}
+		args = append(args, "+delete", ")")
+	}
+
+	for _, req := range unscaled {
+		args = append(args, crop(req)...)
+	}
+
+	return append(args, "null:")
+}
+
+func (r *imageMagickRenderer) run(args []string) error {
+	output, err := runCommand(r.command[0], args...)
+	if err != nil {
+		return MultiErrorFromErrors([]error{errors.New(output), err})
+	}
+
+	return nil
+}
+
+func (r *imageMagickRenderer) Render(req RenderRequest) error {
+	if req.contained() {
+		args, err := r.containArgs(req)
+		if err != nil {
+			return err
+		}
+
+		return r.run(args)
+	}
+
+	return r.run(r.args(req))
+}
+
+// Contained slices need a command of their own, but everything else is
+//   produced together.
+func (r *imageMagickRenderer) RenderBatch(reqs []RenderRequest) error {
+	contained, reqs := splitContained(reqs)
+
+	var errs []error
+	if len(reqs) > 0 {
+		errs = append(errs, r.run(r.batchArgs(reqs)))
+	}
+
+	for _, req := range contained {
+		errs = append(errs, r.Render(req))
+	}
+
+	if err := MultiErrorFromErrors(errs); err.Exists() {
+		return err
+	}
+
+	return nil
+}
+
+func (r *graphicsMagickRenderer) Render(req RenderRequest) error {
+	if req.contained() && (req.Fill == FillEdge || req.Fill == FillBlur) {
+		return errors.New(fmt.Sprintf("GraphicsMagick renderer can't fill slices with (%s)", req.Fill))
+	}
+
+	return r.renderer.Render(req)
+}
@@ -0,0 +1,287 @@
+package wp
+
+import (
+	"errors"
+	"image"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageMagickRendererCommands(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	req := RenderRequest{
+		SourcePath: "abc.jpg",
+		OutputPath: "out.jpg",
+		Gravity:    "West",
+		Size:       image.Pt(64, 32),
+		Scaled:     true,
+	}
+
+	expected := map[string][]string{
+		RendererImageMagick:    []string{"convert", "abc.jpg", "-auto-orient", "-gravity", "West", "-scale", "64x32^", "-extent", "64x32", "out.jpg"},
+		RendererImageMagick7:   []string{"magick", "abc.jpg", "-auto-orient", "-gravity", "West", "-scale", "64x32^", "-extent", "64x32", "out.jpg"},
+		RendererGraphicsMagick: []string{"gm", "convert", "abc.jpg", "-auto-orient", "-gravity", "West", "-scale", "64x32^", "-extent", "64x32", "out.jpg"},
+	}
+
+	for name, command := range expected {
+		called := false
+		runCommand = func(name string, args ...string) (string, error) {
+			called = true
+			assert.Equal(t, command, append([]string{name}, args...))
+			return "", nil
+		}
+
+		assert.NoError(t, newRenderer(name).Render(req))
+		assert.True(t, called)
+	}
+}
+
+func TestImageMagickRendererFailure(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	runCommand = func(name string, args ...string) (string, error) {
+		return "convert: no decode delegate", errors.New("exit status 1")
+	}
+
+	err := newRenderer(RendererImageMagick).Render(RenderRequest{Gravity: "Center", Size: image.Pt(1, 1)})
+	assert.Equal(t, "convert: no decode delegate\nexit status 1", err.Error())
+}
+
+func TestImageMagickRendererBatch(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	reqs := []RenderRequest{
+		{SourcePath: "abc.jpg", OutputPath: "a.jpg", Gravity: "West", Size: image.Pt(64, 32), Scaled: true},
+		{SourcePath: "abc.jpg", OutputPath: "b.jpg", Gravity: "North", Size: image.Pt(64, 32)},
+		{SourcePath: "abc.jpg", OutputPath: "c.jpg", Gravity: "East", Size: image.Pt(64, 32), Scaled: true},
+	}
+
+	called := false
+	runCommand = func(name string, args ...string) (string, error) {
+		called = true
+		assert.Equal(t, "magick", name)
+		assert.Equal(t, concatArgs(
+			[]string{"abc.jpg", "-auto-orient"},
+			[]string{"(", "+clone", "-scale", "64x32^"},
+			batchCropArgs("West", "64x32", "a.jpg"),
+			batchCropArgs("East", "64x32", "c.jpg"),
+			[]string{"+delete", ")"},
+			batchCropArgs("North", "64x32", "b.jpg"),
+			[]string{"null:"},
+		), args)
+		return "", nil
+	}
+
+	r, ok := newRenderer(RendererImageMagick7).(BatchRenderer)
+	assert.True(t, ok)
+	assert.NoError(t, r.RenderBatch(reqs))
+	assert.True(t, called)
+}
+
+func TestGraphicsMagickRendererIsNotBatched(t *testing.T) {
+	_, ok := newRenderer(RendererGraphicsMagick).(BatchRenderer)
+	assert.False(t, ok)
+}
+
+func TestImageMagickRendererFilterAndSharpen(t *testing.T) {
+	r := &imageMagickRenderer{[]string{"convert"}}
+
+	req := RenderRequest{
+		SourcePath: "abc.jpg",
+		OutputPath: "out.jpg",
+		Gravity:    "Center",
+		Size:       image.Pt(64, 32),
+		Scaled:     true,
+		Filter:     FilterLanczos,
+		Sharpen:    0.5,
+	}
+
+	assert.Equal(t, []string{
+		"abc.jpg", "-auto-orient", "-gravity", "Center",
+		"-filter", "Lanczos", "-resize", "64x32^",
+		"-unsharp", "0x1+0.5+0",
+		"-extent", "64x32", "out.jpg",
+	}, r.args(req))
+
+	req.Filter = FilterBox
+	req.Sharpen = 0
+	assert.Equal(t, []string{"abc.jpg", "-auto-orient", "-gravity", "Center", "-scale", "64x32^", "-extent", "64x32", "out.jpg"}, r.args(req))
+
+	// Filters mean nothing to slices that aren't scaled.
+	req.Filter = FilterMitchell
+	req.Scaled = false
+	assert.Equal(t, []string{"abc.jpg", "-auto-orient", "-gravity", "Center", "-extent", "64x32", "out.jpg"}, r.args(req))
+}
+
+func TestImageMagickRendererQuality(t *testing.T) {
+	r := &imageMagickRenderer{[]string{"convert"}}
+
+	req := RenderRequest{
+		SourcePath:  "abc.png",
+		OutputPath:  "out.webp",
+		Gravity:     "Center",
+		Size:        image.Pt(64, 32),
+		Quality:     80,
+		Compression: 9,
+	}
+
+	assert.Equal(t, []string{"abc.png", "-auto-orient", "-gravity", "Center", "-extent", "64x32", "-quality", "80", "out.webp"}, r.args(req))
+
+	req.OutputPath = "out.png"
+	assert.Equal(t, []string{"abc.png", "-auto-orient", "-gravity", "Center", "-extent", "64x32", "-define", "png:compression-level=9", "out.png"}, r.args(req))
+
+	req.OutputPath = "out.webp"
+	assert.Equal(t, concatArgs(
+		[]string{"abc.png", "-auto-orient"},
+		[]string{"(", "+clone", "-gravity", "Center", "-extent", "64x32", "-quality", "80", "-write", "out.webp", "+delete", ")"},
+		[]string{"(", "+clone", "-gravity", "North", "-extent", "64x32", "-quality", "80", "-write", "out2.webp", "+delete", ")"},
+		[]string{"null:"},
+	), r.batchArgs([]RenderRequest{req, {SourcePath: "abc.png", OutputPath: "out2.webp", Gravity: "North", Size: image.Pt(64, 32), Quality: 80}}))
+}
+
+func TestImageMagickRendererOffset(t *testing.T) {
+	r := &imageMagickRenderer{[]string{"convert"}}
+
+	req := RenderRequest{
+		SourcePath: "abc.jpg",
+		OutputPath: "out.jpg",
+		Offset:     image.Pt(12, -4),
+		Size:       image.Pt(64, 32),
+		Scaled:     true,
+	}
+
+	assert.Equal(t, []string{"abc.jpg", "-auto-orient", "-gravity", "NorthWest", "-scale", "64x32^", "-extent", "64x32+12-4", "out.jpg"}, r.args(req))
+	assert.Equal(t, concatArgs(
+		[]string{"abc.jpg", "-auto-orient"},
+		[]string{"(", "+clone", "-scale", "64x32^"},
+		[]string{"(", "+clone", "-gravity", "NorthWest", "-extent", "64x32+12-4", "-write", "out.jpg", "+delete", ")"},
+		[]string{"+delete", ")"},
+		[]string{"null:"},
+	), r.batchArgs([]RenderRequest{req}))
+}
+
+func TestImageMagickRendererZoom(t *testing.T) {
+	r := &imageMagickRenderer{[]string{"convert"}}
+
+	req := RenderRequest{
+		SourcePath: "abc.jpg",
+		OutputPath: "out.jpg",
+		Gravity:    "North",
+		Size:       image.Pt(64, 32),
+		Scaled:     true,
+		Zoom:       1.5,
+	}
+
+	assert.Equal(t, []string{"abc.jpg", "-auto-orient", "-gravity", "North", "-scale", "96x48^", "-extent", "64x32", "out.jpg"}, r.args(req))
+}
+
+func TestImageMagickRendererTransformed(t *testing.T) {
+	r := &imageMagickRenderer{[]string{"convert"}}
+
+	req := RenderRequest{
+		SourcePath: "abc.jpg",
+		OutputPath: "out.jpg",
+		Gravity:    "North",
+		Size:       image.Pt(64, 32),
+		Rotate:     270,
+		Flip:       FlipHorizontal,
+	}
+
+	assert.Equal(t, []string{"abc.jpg", "-auto-orient", "-rotate", "270", "-flop", "-gravity", "North", "-extent", "64x32", "out.jpg"}, r.args(req))
+
+	req.Rotate = 0
+	req.Flip = FlipVertical
+	assert.Equal(t, concatArgs(
+		[]string{"abc.jpg", "-auto-orient", "-flip"},
+		[]string{"(", "+clone", "-gravity", "North", "-extent", "64x32", "-write", "out.jpg", "+delete", ")"},
+		[]string{"null:"},
+	), r.batchArgs([]RenderRequest{req}))
+}
+
+func TestImageMagickRendererContained(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "tall.jpg"))
+	assert.NoError(t, err)
+
+	r := &imageMagickRenderer{[]string{"convert"}}
+
+	req := RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: "out.jpg",
+		Gravity:    "East",
+		Size:       image.Pt(256, 64),
+		Scaled:     true,
+		Fit:        FitContain,
+		Fill:       "#123",
+	}
+
+	args, err := r.containArgs(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{sourceImage, "-auto-orient", "-scale", "256x64", "-background", "#112233", "-gravity", "East", "-extent", "256x64", "out.jpg"}, args)
+
+	req.Fill = FillEdge
+	args, err = r.containArgs(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		sourceImage, "-auto-orient", "-scale", "256x64",
+		"-set", "option:distort:viewport", "256x64-224+0", "-virtual-pixel", "edge", "-filter", "Point", "-distort", "SRT", "0", "+repage",
+		"out.jpg",
+	}, args)
+
+	req.Fill = FillBlur
+	args, err = r.containArgs(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		sourceImage, "-auto-orient",
+		"(", "-clone", "0", "-scale", "256x64^", "-gravity", "Center", "-extent", "256x64", "-blur", "0x20", "-fill", "black", "-colorize", "40%", ")",
+		"(", "-clone", "0", "-scale", "256x64", ")",
+		"-delete", "0", "-gravity", "East", "-composite",
+		"out.jpg",
+	}, args)
+}
+
+func TestImageMagickRendererBatchContained(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	reqs := []RenderRequest{
+		{SourcePath: "abc.jpg", OutputPath: "a.jpg", Gravity: "West", Size: image.Pt(64, 32), Scaled: true},
+		{SourcePath: "abc.jpg", OutputPath: "b.jpg", Gravity: "Center", Size: image.Pt(64, 32), Scaled: true, Fit: FitContain},
+	}
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, args)
+		return "", nil
+	}
+
+	r := &imageMagickRenderer{[]string{"magick"}}
+	assert.NoError(t, r.RenderBatch(reqs))
+	assert.Equal(t, [][]string{
+		r.batchArgs(reqs[:1]),
+		{"abc.jpg", "-auto-orient", "-scale", "64x32", "-background", "#000000", "-gravity", "Center", "-extent", "64x32", "b.jpg"},
+	}, calls)
+}
+
+func TestGraphicsMagickRendererContainedFills(t *testing.T) {
+	err := newRenderer(RendererGraphicsMagick).Render(RenderRequest{Gravity: "Center", Size: image.Pt(1, 1), Scaled: true, Fit: FitContain, Fill: FillBlur})
+	assert.Equal(t, "GraphicsMagick renderer can't fill slices with (blur)", err.Error())
+}
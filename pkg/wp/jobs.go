@@ -0,0 +1,34 @@
+package wp
+
+import (
+	"sync"
+)
+
+// Call fn once for every index in [0, count), with at most jobs calls
+//   running at any one time.
+// Blocks until every call has returned.
+func RunJobs(jobs int, count int, fn func(i int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indices <- i
+	}
+
+	close(indices)
+	wg.Wait()
+}
@@ -0,0 +1,55 @@
+package wp
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunJobsCallsEveryIndex(t *testing.T) {
+	called := make([]int, 20)
+
+	RunJobs(4, len(called), func(i int) {
+		called[i]++
+	})
+
+	for _, c := range called {
+		assert.Equal(t, 1, c)
+	}
+}
+
+func TestRunJobsBoundsConcurrency(t *testing.T) {
+	var mutex sync.Mutex
+	running := 0
+	maxRunning := 0
+
+	RunJobs(3, 12, func(i int) {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+	})
+
+	assert.Equal(t, 3, maxRunning)
+}
+
+func TestRunJobsNoJobs(t *testing.T) {
+	called := 0
+	RunJobs(0, 2, func(i int) {
+		called++
+	})
+
+	assert.Equal(t, 2, called)
+}
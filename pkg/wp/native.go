@@ -0,0 +1,281 @@
+package wp
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// JPEG quality used when writing output; ImageMagick's default when it can't
+//   work out the quality of the source.
+const nativeJpegQuality int = 92
+
+// Decode the image at the provided path into an RGBA image whose bounds start
+//   at the origin.
+// The image is rotated and flipped according to its EXIF orientation, so that
+//   it's upright.
+func decodeImage(imagePath string) (*image.RGBA, error) {
+	sourceImage, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer sourceImage.Close()
+
+	img, _, err := image.Decode(sourceImage)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	orientation, err := readOrientation(imagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return orientImage(rgba, orientation), nil
+}
+
+// Get the compression level the PNG encoder should use for a zlib style
+//   compression level.
+// The encoder only offers a few levels, so the closest one is used.
+func pngCompressionLevel(compression int) png.CompressionLevel {
+	switch {
+	case compression == 0:
+		return png.DefaultCompression
+	case compression <= 3:
+		return png.BestSpeed
+	case compression <= 6:
+		return png.DefaultCompression
+	}
+
+	return png.BestCompression
+}
+
+// The native renderer can only write the formats the standard library has
+//   encoders for.
+func (r *nativeRenderer) CheckFormat(format string) error {
+	switch format {
+	case "", FormatJPEG, FormatPNG:
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf("Native renderer can't write slices in format (%s); install ImageMagick, GraphicsMagick, or libvips to use it", format))
+}
+
+// Write the image to the requested output path, choosing the encoder from
+//   the path's extension.
+func encodeImage(req RenderRequest, img image.Image) error {
+	quality := nativeJpegQuality
+	if req.Quality > 0 {
+		quality = req.Quality
+	}
+
+	var encode func(f *os.File) error
+	switch formatOfPath(req.OutputPath) {
+	case FormatJPEG:
+		encode = func(f *os.File) error {
+			return jpeg.Encode(f, img, &jpeg.Options{Quality: quality})
+		}
+	case FormatPNG:
+		encode = func(f *os.File) error {
+			encoder := png.Encoder{CompressionLevel: pngCompressionLevel(req.Compression)}
+			return encoder.Encode(f, img)
+		}
+	case "gif":
+		encode = func(f *os.File) error {
+			return gif.Encode(f, img, nil)
+		}
+	default:
+		extension := strings.ToLower(path.Ext(req.OutputPath))
+		return errors.New(fmt.Sprintf("Native renderer can't write images of type (%s)", extension))
+	}
+
+	out, err := os.Create(req.OutputPath)
+	if err != nil {
+		return err
+	}
+
+	if err := encode(out); err != nil {
+		out.Close()
+		os.Remove(req.OutputPath)
+		return err
+	}
+
+	return out.Close()
+}
+
+// Cut a region of the given size out of the image, positioned with the given
+//   gravity.
+// Equivalent to ImageMagick's `-gravity <gravity> -extent WxH`; any area not
+//   covered by the image is filled with white.
+func extentImage(img *image.RGBA, gravity string, size image.Point) (*image.RGBA, error) {
+	offset, err := gravityOffset(gravity, img.Bounds().Size(), size)
+	if err != nil {
+		return nil, err
+	}
+
+	return cropImage(img, offset, size), nil
+}
+
+// Cut a region of the given size out of the image, with its top left corner
+//   at offset; any area not covered by the image is filled with white.
+func cropImage(img *image.RGBA, offset image.Point, size image.Point) *image.RGBA {
+	out := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	draw.Draw(out, out.Bounds(), image.White, image.ZP, draw.Src)
+	draw.Draw(out, out.Bounds(), img, offset, draw.Src)
+	return out
+}
+
+// Build the background of a contained slice, given the source, the scaled
+//   source, and where the scaled source will be drawn.
+func fillBackground(img *image.RGBA, fitted *image.RGBA, offset image.Point, req RenderRequest) *image.RGBA {
+	switch req.Fill {
+	case FillEdge:
+		// Every pixel takes the colour of the nearest pixel of the source.
+		size := fitted.Bounds().Size()
+		out := image.NewRGBA(image.Rect(0, 0, req.Size.X, req.Size.Y))
+		for y := 0; y < req.Size.Y; y++ {
+			sy := clampInt(y-offset.Y, 0, size.Y-1)
+			for x := 0; x < req.Size.X; x++ {
+				sx := clampInt(x-offset.X, 0, size.X-1)
+				copy(out.Pix[out.PixOffset(x, y):out.PixOffset(x, y)+4], fitted.Pix[fitted.PixOffset(sx, sy):])
+			}
+		}
+		return out
+	case FillBlur:
+		// Blurring a small copy, then enlarging it, looks the same as blurring
+		//   a full size copy, for a fraction of the work.
+		const shrink = 8
+		cover := scaleToFill(img.Bounds().Size(), req.Size)
+		small := image.Pt(maxInt(1, cover.X/shrink), maxInt(1, cover.Y/shrink))
+
+		background := resample(img, small, FilterBox)
+		background = convolve(
+			background,
+			small,
+			gaussianContributions(fillBlurSigma/shrink, small.X),
+			gaussianContributions(fillBlurSigma/shrink, small.Y),
+		)
+		background = resample(background, cover, FilterTriangle)
+
+		centerOffset, _ := gravityOffset("Center", cover, req.Size)
+		out := cropImage(background, centerOffset, req.Size)
+		for i := 0; i < len(out.Pix); i += 4 {
+			for j := 0; j < 3; j++ {
+				out.Pix[i+j] = clampChannel(float64(out.Pix[i+j]) * fillBlurDarken)
+			}
+		}
+		return out
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, req.Size.X, req.Size.Y))
+	draw.Draw(out, out.Bounds(), image.NewUniform(req.fillColor()), image.ZP, draw.Src)
+	return out
+}
+
+// Scale the whole image to fit within the requested slice, placed with the
+//   request's gravity, and fill the rest of the slice.
+func containImage(img *image.RGBA, req RenderRequest) (*image.RGBA, error) {
+	fittedSize := scaleToFit(img.Bounds().Size(), req.Size)
+	offset, err := req.containOffset(fittedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	fitted := sharpen(resample(img, fittedSize, req.Filter), req.Sharpen)
+
+	out := fillBackground(img, fitted, offset, req)
+	draw.Draw(out, image.Rectangle{offset, offset.Add(fittedSize)}, fitted, image.ZP, draw.Over)
+	return out, nil
+}
+
+// Number of slices from a single batch the native renderer cuts and encodes
+//   at once.
+var nativeJobs int = runtime.NumCPU()
+
+// Limit how many slices from a single batch the native renderer cuts and
+//   encodes at once, so that many batches being rendered at once don't each
+//   try to use every CPU.
+func SetNativeJobs(jobs int) {
+	nativeJobs = jobs
+}
+
+// Renders slices in-process, without needing any external tools.
+type nativeRenderer struct{}
+
+func (r *nativeRenderer) Render(req RenderRequest) error {
+	return r.RenderBatch([]RenderRequest{req})
+}
+
+func (r *nativeRenderer) RenderBatch(reqs []RenderRequest) error {
+	img, err := reqs[0].decodeSource()
+	if err != nil {
+		return err
+	}
+
+	// Pair each request up with the image it's cut from, so that all of the
+	//   cutting and encoding can happen concurrently.
+	sources := make([]*image.RGBA, 0, len(reqs))
+	ordered := make([]RenderRequest, 0, len(reqs))
+
+	// Contained slices do all of their own scaling, so start from the source.
+	contained, reqs := splitContained(reqs)
+	for _, req := range contained {
+		sources = append(sources, img)
+		ordered = append(ordered, req)
+	}
+
+	unscaled, scaled := partitionRequests(reqs)
+	for _, group := range scaled {
+		scaledImg := resample(img, group[0].frame(img.Bounds().Size()), group[0].Filter)
+		scaledImg = sharpen(scaledImg, group[0].Sharpen)
+		for _, req := range group {
+			sources = append(sources, scaledImg)
+			ordered = append(ordered, req)
+		}
+	}
+
+	for _, req := range unscaled {
+		sources = append(sources, img)
+		ordered = append(ordered, req)
+	}
+
+	errs := make([]error, len(ordered))
+	RunJobs(nativeJobs, len(ordered), func(i int) {
+		if ordered[i].contained() {
+			out, err := containImage(sources[i], ordered[i])
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			errs[i] = encodeImage(ordered[i], out)
+			return
+		}
+
+		offset, err := ordered[i].offset(sources[i].Bounds().Size())
+		if err != nil {
+			errs[i] = err
+			return
+		}
+
+		errs[i] = encodeImage(ordered[i], cropImage(sources[i], offset, ordered[i].Size))
+	})
+
+	if err := MultiErrorFromErrors(errs); err.Exists() {
+		return err
+	}
+
+	return nil
+}
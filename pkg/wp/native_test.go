@@ -0,0 +1,294 @@
+package wp
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtentImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(3, 1, color.RGBA{255, 0, 0, 255})
+
+	out, err := extentImage(img, "SouthEast", image.Pt(2, 2))
+	assert.NoError(t, err)
+
+	assert.Equal(t, image.Rect(0, 0, 2, 2), out.Bounds())
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, out.RGBAAt(1, 1))
+	assert.Equal(t, color.RGBA{0, 0, 0, 0}, out.RGBAAt(0, 0))
+}
+
+func TestExtentImageFillsWhite(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	out, err := extentImage(img, "NorthWest", image.Pt(3, 3))
+	assert.NoError(t, err)
+
+	assert.Equal(t, color.RGBA{0, 0, 0, 0}, out.RGBAAt(1, 1))
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, out.RGBAAt(2, 2))
+}
+
+func TestCropImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(2, 1, color.RGBA{255, 0, 0, 255})
+
+	out := cropImage(img, image.Pt(1, -1), image.Pt(2, 3))
+	assert.Equal(t, image.Rect(0, 0, 2, 3), out.Bounds())
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, out.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, out.RGBAAt(1, 2))
+}
+
+func TestEncodeImageUnknownType(t *testing.T) {
+	err := encodeImage(RenderRequest{OutputPath: "image.tga"}, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	assert.Equal(t, "Native renderer can't write images of type (.tga)", err.Error())
+
+	err = encodeImage(RenderRequest{OutputPath: "image.webp"}, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	assert.Equal(t, "Native renderer can't write images of type (.webp)", err.Error())
+}
+
+func TestEncodeImageQuality(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+
+	low := path.Join(tempDir, "low.jpeg")
+	high := path.Join(tempDir, "high.jpeg")
+	assert.NoError(t, encodeImage(RenderRequest{OutputPath: low, Quality: 10}, img))
+	assert.NoError(t, encodeImage(RenderRequest{OutputPath: high, Quality: 100}, img))
+
+	lowInfo, err := os.Stat(low)
+	assert.NoError(t, err)
+	highInfo, err := os.Stat(high)
+	assert.NoError(t, err)
+
+	assert.True(t, lowInfo.Size() < highInfo.Size())
+}
+
+func TestPngCompressionLevel(t *testing.T) {
+	assert.Equal(t, png.DefaultCompression, pngCompressionLevel(0))
+	assert.Equal(t, png.BestSpeed, pngCompressionLevel(1))
+	assert.Equal(t, png.DefaultCompression, pngCompressionLevel(6))
+	assert.Equal(t, png.BestCompression, pngCompressionLevel(9))
+}
+
+func TestNativeRendererScaled(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	outputPath := path.Join(tempDir, "wide_scaled_east.png")
+
+	r := &nativeRenderer{}
+	err = r.Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: outputPath,
+		Gravity:    "East",
+		Size:       image.Pt(64, 64),
+		Scaled:     true,
+	})
+	assert.NoError(t, err)
+
+	dims, err := GetImageDimensions(outputPath)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(64, 64), dims)
+}
+
+func TestNativeRendererUnscaled(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "tall.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	outputPath := path.Join(tempDir, "tall_north.jpg")
+
+	r := &nativeRenderer{}
+	err = r.Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: outputPath,
+		Gravity:    "North",
+		Size:       image.Pt(100, 50),
+	})
+	assert.NoError(t, err)
+
+	dims, err := GetImageDimensions(outputPath)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(100, 50), dims)
+}
+
+func TestNativeRendererOriented(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Stored wide, but displayed tall, with its red corner at the top right.
+	sourceImage := path.Join(tempDir, "rotated.jpg")
+	writeOrientedJpeg(t, sourceImage, image.Pt(64, 32), orientationRotate90)
+
+	outputPath := path.Join(tempDir, "rotated_north.png")
+
+	r := &nativeRenderer{}
+	err = r.Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: outputPath,
+		Gravity:    "North",
+		Size:       image.Pt(32, 32),
+	})
+	assert.NoError(t, err)
+
+	f, err := os.Open(outputPath)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+
+	r0, _, b0, _ := img.At(24, 8).RGBA()
+	assert.True(t, r0 > 0xc000 && b0 < 0x4000)
+}
+
+func TestNativeRendererTransformed(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Red in the top left corner, which rotating moves to the top right, and
+	//   flipping afterwards moves to the bottom right.
+	sourceImage := path.Join(tempDir, "source.jpg")
+	writeOrientedJpeg(t, sourceImage, image.Pt(64, 32), orientationNormal)
+
+	outputPath := path.Join(tempDir, "source_rot90_flipv_south.png")
+
+	r := &nativeRenderer{}
+	err = r.Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: outputPath,
+		Gravity:    "South",
+		Size:       image.Pt(32, 32),
+		Rotate:     90,
+		Flip:       FlipVertical,
+	})
+	assert.NoError(t, err)
+
+	f, err := os.Open(outputPath)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(32, 32), img.Bounds().Size())
+
+	r0, _, b0, _ := img.At(24, 24).RGBA()
+	assert.True(t, r0 > 0xc000 && b0 < 0x4000)
+
+	r1, g1, _, _ := img.At(8, 8).RGBA()
+	assert.True(t, r1 < 0x4000 && g1 < 0x4000)
+}
+
+func TestNativeRendererBatch(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	reqs := []RenderRequest{
+		{SourcePath: sourceImage, OutputPath: path.Join(tempDir, "a.jpg"), Gravity: "West", Size: image.Pt(64, 64), Scaled: true},
+		{SourcePath: sourceImage, OutputPath: path.Join(tempDir, "b.png"), Gravity: "North", Size: image.Pt(32, 16)},
+		{SourcePath: sourceImage, OutputPath: path.Join(tempDir, "c.gif"), Gravity: "East", Size: image.Pt(64, 64), Scaled: true},
+	}
+
+	r := &nativeRenderer{}
+	assert.NoError(t, r.RenderBatch(reqs))
+
+	for _, req := range reqs {
+		dims, err := GetImageDimensions(req.OutputPath)
+		assert.NoError(t, err)
+		assert.Equal(t, req.Size, dims)
+	}
+}
+
+func TestContainImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 8))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.ZP, draw.Src)
+
+	req := RenderRequest{Gravity: "Center", Size: image.Pt(8, 8), Scaled: true, Fit: FitContain, Fill: "white"}
+	out, err := containImage(img, req)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 8, 8), out.Bounds())
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, out.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, out.RGBAAt(2, 4))
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, out.RGBAAt(7, 7))
+
+	req.Gravity = "West"
+	out, err = containImage(img, req)
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, out.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, out.RGBAAt(4, 0))
+
+	req.Fill = FillEdge
+	out, err = containImage(img, req)
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, out.RGBAAt(7, 7))
+
+	req.Gravity = "Up"
+	_, err = containImage(img, req)
+	assert.Equal(t, "Unknown gravity (Up)", err.Error())
+}
+
+func TestContainImageBlur(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 80))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{200, 200, 200, 255}), image.ZP, draw.Src)
+
+	out, err := containImage(img, RenderRequest{Gravity: "Center", Size: image.Pt(80, 80), Scaled: true, Fit: FitContain, Fill: FillBlur})
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{120, 120, 120, 255}, out.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{200, 200, 200, 255}, out.RGBAAt(40, 40))
+}
+
+func TestNativeRendererContained(t *testing.T) {
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "tall.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	reqs := []RenderRequest{
+		{SourcePath: sourceImage, OutputPath: path.Join(tempDir, "a.png"), Gravity: "Center", Size: image.Pt(256, 64), Scaled: true, Fit: FitContain, Fill: FillBlur},
+		{SourcePath: sourceImage, OutputPath: path.Join(tempDir, "b.png"), Gravity: "North", Size: image.Pt(64, 64), Scaled: true},
+	}
+
+	r := &nativeRenderer{}
+	assert.NoError(t, r.RenderBatch(reqs))
+
+	for _, req := range reqs {
+		dims, err := GetImageDimensions(req.OutputPath)
+		assert.NoError(t, err)
+		assert.Equal(t, req.Size, dims)
+	}
+}
@@ -0,0 +1,170 @@
+package wp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"os"
+)
+
+// EXIF orientations, describing how an image's stored pixels have to be
+//   transformed to display it upright.
+const (
+	orientationNormal     int = 1
+	orientationFlipH      int = 2
+	orientationRotate180  int = 3
+	orientationFlipV      int = 4
+	orientationTranspose  int = 5
+	orientationRotate90   int = 6
+	orientationTransverse int = 7
+	orientationRotate270  int = 8
+)
+
+const exifOrientationTag uint16 = 0x0112
+
+// Whether displaying an image with the given orientation swaps its width and
+//   height.
+func orientationSwapsAxes(orientation int) bool {
+	return orientation >= orientationTranspose && orientation <= orientationRotate270
+}
+
+// Read the orientation tag out of a TIFF structure, which is what EXIF data
+//   is stored as.
+// Returns orientationNormal if there's no usable orientation tag.
+func tiffOrientation(r io.ReaderAt) int {
+	orientation, ok := readTiffTags(r, exifOrientationTag)[exifOrientationTag]
+	if !ok || orientation < orientationNormal || orientation > orientationRotate270 {
+		return orientationNormal
+	}
+
+	return orientation
+}
+
+// Find the EXIF segment of a JPEG, and read the orientation out of it.
+func jpegOrientation(r *bufio.Reader) (int, error) {
+	marker := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(r, marker[:1]); err != nil {
+			return orientationNormal, nil
+		}
+		if marker[0] != 0xff {
+			return orientationNormal, nil
+		}
+
+		// Markers may be padded with any number of 0xff bytes.
+		for marker[1] = 0xff; marker[1] == 0xff; {
+			b, err := r.ReadByte()
+			if err != nil {
+				return orientationNormal, nil
+			}
+			marker[1] = b
+		}
+
+		// Start of scan; there's no metadata after this.
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			return orientationNormal, nil
+		}
+
+		// Markers without any payload.
+		if marker[1] == 0x01 || (marker[1] >= 0xd0 && marker[1] <= 0xd8) {
+			continue
+		}
+
+		length := make([]byte, 2)
+		if _, err := io.ReadFull(r, length); err != nil {
+			return orientationNormal, nil
+		}
+
+		size := int(binary.BigEndian.Uint16(length)) - 2
+		if size < 0 {
+			return orientationNormal, nil
+		}
+
+		if marker[1] != 0xe1 {
+			if _, err := r.Discard(size); err != nil {
+				return orientationNormal, nil
+			}
+			continue
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return orientationNormal, nil
+		}
+
+		if bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return tiffOrientation(bytes.NewReader(payload[6:])), nil
+		}
+	}
+}
+
+// Get the EXIF orientation of the image at the provided path.
+// Images without any orientation information, or in formats that aren't
+//   understood, are treated as upright.
+func readOrientation(imagePath string) (int, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return orientationNormal, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(4)
+	if err != nil {
+		return orientationNormal, nil
+	}
+
+	if magic[0] == 0xff && magic[1] == 0xd8 {
+		r.Discard(2)
+		return jpegOrientation(r)
+	}
+
+	return tiffOrientation(f), nil
+}
+
+// Transform the image so that an image stored with the given orientation is
+//   upright.
+func orientImage(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= orientationNormal || orientation > orientationRotate270 {
+		return src
+	}
+
+	size := src.Bounds().Size()
+	w, h := size.X, size.Y
+
+	dstSize := size
+	if orientationSwapsAxes(orientation) {
+		dstSize = image.Pt(h, w)
+	}
+
+	// Where each destination pixel comes from in the source.
+	var source func(x, y int) (int, int)
+	switch orientation {
+	case orientationFlipH:
+		source = func(x, y int) (int, int) { return w - 1 - x, y }
+	case orientationRotate180:
+		source = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case orientationFlipV:
+		source = func(x, y int) (int, int) { return x, h - 1 - y }
+	case orientationTranspose:
+		source = func(x, y int) (int, int) { return y, x }
+	case orientationRotate90:
+		source = func(x, y int) (int, int) { return y, h - 1 - x }
+	case orientationTransverse:
+		source = func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }
+	case orientationRotate270:
+		source = func(x, y int) (int, int) { return w - 1 - y, x }
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstSize.X, dstSize.Y))
+	for y := 0; y < dstSize.Y; y++ {
+		for x := 0; x < dstSize.X; x++ {
+			sx, sy := source(x, y)
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):])
+		}
+	}
+
+	return dst
+}
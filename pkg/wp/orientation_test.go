@@ -0,0 +1,131 @@
+package wp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+// Build a TIFF structure holding just an orientation tag.
+func orientationTiff(order binary.ByteOrder, orientation int) []byte {
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II*\x00")
+	} else {
+		buf.WriteString("MM\x00*")
+	}
+
+	binary.Write(&buf, order, uint32(8))
+	binary.Write(&buf, order, uint16(1))
+	binary.Write(&buf, order, exifOrientationTag)
+	binary.Write(&buf, order, uint16(3))
+	binary.Write(&buf, order, uint32(1))
+	binary.Write(&buf, order, uint16(orientation))
+	binary.Write(&buf, order, uint16(0))
+	binary.Write(&buf, order, uint32(0))
+	return buf.Bytes()
+}
+
+// Write a JPEG of the given size whose top left quarter is red, and that's
+//   tagged with the given EXIF orientation.
+func writeOrientedJpeg(t *testing.T, imagePath string, size image.Point, orientation int) {
+	img := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	red := image.NewUniform(color.RGBA{255, 0, 0, 255})
+	draw.Draw(img, image.Rect(0, 0, size.X/2, size.Y/2), red, image.ZP, draw.Src)
+
+	var encoded bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 100}))
+
+	payload := append([]byte("Exif\x00\x00"), orientationTiff(binary.BigEndian, orientation)...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+
+	var out bytes.Buffer
+	out.Write(encoded.Bytes()[:2])
+	out.Write(segment)
+	out.Write(payload)
+	out.Write(encoded.Bytes()[2:])
+	assert.NoError(t, ioutil.WriteFile(imagePath, out.Bytes(), 0644))
+}
+
+func TestReadOrientation(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	for orientation := orientationNormal; orientation <= orientationRotate270; orientation++ {
+		imagePath := path.Join(tempDir, "oriented.jpg")
+		writeOrientedJpeg(t, imagePath, image.Pt(4, 2), orientation)
+
+		read, err := readOrientation(imagePath)
+		assert.NoError(t, err)
+		assert.Equal(t, orientation, read)
+	}
+}
+
+func TestReadOrientationTiff(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	imagePath := path.Join(tempDir, "oriented.tiff")
+	assert.NoError(t, ioutil.WriteFile(imagePath, orientationTiff(binary.LittleEndian, orientationRotate90), 0644))
+
+	orientation, err := readOrientation(imagePath)
+	assert.NoError(t, err)
+	assert.Equal(t, orientationRotate90, orientation)
+}
+
+func TestReadOrientationMissing(t *testing.T) {
+	orientation, err := readOrientation(path.Join("..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, orientationNormal, orientation)
+
+	_, err = readOrientation("/not/a/file.jpg")
+	assert.Error(t, err)
+}
+
+func TestReadOrientationInvalid(t *testing.T) {
+	assert.Equal(t, orientationNormal, tiffOrientation(bytes.NewReader(orientationTiff(binary.BigEndian, 9))))
+	assert.Equal(t, orientationNormal, tiffOrientation(bytes.NewReader([]byte("II*\x00"))))
+}
+
+func TestOrientImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	red := color.RGBA{255, 0, 0, 255}
+	img.Set(0, 0, red)
+
+	// Where the top left pixel of the stored image ends up once it's been
+	//   made upright.
+	expected := map[int]image.Point{
+		orientationNormal:     image.Pt(0, 0),
+		orientationFlipH:      image.Pt(2, 0),
+		orientationRotate180:  image.Pt(2, 1),
+		orientationFlipV:      image.Pt(0, 1),
+		orientationTranspose:  image.Pt(0, 0),
+		orientationRotate90:   image.Pt(1, 0),
+		orientationTransverse: image.Pt(1, 2),
+		orientationRotate270:  image.Pt(0, 2),
+	}
+
+	for orientation, point := range expected {
+		out := orientImage(img, orientation)
+		if orientationSwapsAxes(orientation) {
+			assert.Equal(t, image.Rect(0, 0, 2, 3), out.Bounds())
+		} else {
+			assert.Equal(t, image.Rect(0, 0, 3, 2), out.Bounds())
+		}
+		assert.Equal(t, red, out.RGBAAt(point.X, point.Y), "orientation %d", orientation)
+	}
+}
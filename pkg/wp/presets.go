@@ -0,0 +1,187 @@
+package wp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Named dimensions that can be used anywhere dimensions are accepted.
+// Names are matched without regard to case.
+var builtinPresets map[string]string = map[string]string{
+	"720p":                 "1280x720",
+	"1080p":                "1920x1080",
+	"1440p":                "2560x1440",
+	"4k":                   "3840x2160",
+	"5k":                   "5120x2880",
+	"8k":                   "7680x4320",
+	"ultrawide-1080":       "2560x1080",
+	"ultrawide-1440":       "3440x1440",
+	"super-ultrawide-1440": "5120x1440",
+	"macbook-air-13":       "2560x1664",
+	"macbook-air-15":       "2880x1864",
+	"macbook-pro-14":       "3024x1964",
+	"macbook-pro-16":       "3456x2234",
+	"imac-24":              "4480x2520",
+	"studio-display":       "5120x2880",
+	"ipad-pro-11":          "1668x2388",
+	"ipad-pro-12.9":        "2048x2732",
+	"iphone-15":            "1179x2556",
+	"iphone-15-plus":       "1290x2796",
+	"iphone-15-pro":        "1179x2556",
+	"iphone-15-pro-max":    "1290x2796",
+	"pixel-8":              "1080x2400",
+	"pixel-8-pro":          "1344x2992",
+	"galaxy-s24":           "1080x2340",
+	"galaxy-s24-ultra":     "1440x3120",
+}
+
+// Settings read from the user's config file.
+type config struct {
+	// Named dimensions added to, or replacing, the built in presets.
+	Presets map[string]string `json:"presets"`
+}
+
+// Get the path of the user's config file.
+var configPath func() (string, error) = func() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(dir, "wp", "config.json"), nil
+}
+
+// Read the user's config file.
+// Not having a config file at all is the same as having an empty one.
+func readConfig() (config, error) {
+	var c config
+
+	configFile, err := configPath()
+	if err != nil {
+		return c, nil
+	}
+
+	contents, err := ioutil.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal(contents, &c); err != nil {
+		return c, errors.New(fmt.Sprintf("Failed to read config (%s): %s", configFile, err.Error()))
+	}
+
+	return c, nil
+}
+
+// Presets read from the config file the first time one is needed, so that
+//   resolving dimensions doesn't read it again every time, and commands that
+//   never use a preset don't read it at all.
+var presetsOnce sync.Once
+var loadedPresets map[string]string
+var loadedPresetsErr error
+
+// Get every preset, with the user's presets taking precedence over the
+//   built in ones.
+// Names are lower cased.
+// The config file is only read the first time presets are needed.
+func Presets() (map[string]string, error) {
+	presetsOnce.Do(func() {
+		loadedPresets, loadedPresetsErr = readPresets()
+	})
+
+	return loadedPresets, loadedPresetsErr
+}
+
+// Read the user's presets from the config file, and merge them over the
+//   built in ones.
+func readPresets() (map[string]string, error) {
+	c, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	presets := map[string]string{}
+	for name, dimensions := range builtinPresets {
+		presets[name] = dimensions
+	}
+
+	for name, dimensions := range c.Presets {
+		presets[strings.ToLower(name)] = dimensions
+	}
+
+	return presets, nil
+}
+
+// Split the device scale factor off of dimensions like 1440x900@2x.
+// Dimensions without one have a scale factor of 1.
+func splitScaleFactor(str string) (string, float64, error) {
+	scaleFactorMatch := scaleFactorRegexp.FindStringSubmatch(str)
+	if len(scaleFactorMatch) == 0 {
+		return str, 1, nil
+	}
+
+	factor, err := strconv.ParseFloat(scaleFactorMatch[2], 64)
+	if err != nil || factor <= 0 {
+		return "", 0, errors.New(fmt.Sprintf("Provided scale factor (%s) is not valid", scaleFactorMatch[2]))
+	}
+
+	return scaleFactorMatch[1], factor, nil
+}
+
+// Resolve a preset name to the <x>x<y> dimensions it stands for, keeping any
+//   scale factor, like 1440x900@2x, unless it's 1.
+// Dimensions that are already in that form are returned as they are.
+func ResolveDimensions(str string) (string, error) {
+	base, factor, err := splitScaleFactor(str)
+	if err != nil {
+		return "", err
+	}
+
+	suffix := ""
+	if factor != 1 {
+		suffix = "@" + zoomString(factor)
+	}
+
+	if dimensionsRegexp.MatchString(base) {
+		return base + suffix, nil
+	}
+
+	presets, err := Presets()
+	if err != nil {
+		return "", err
+	}
+
+	dimensions, ok := presets[strings.ToLower(base)]
+	if !ok {
+		return "", errors.New(fmt.Sprintf("Provided dimension string (%s) is not valid", str))
+	}
+
+	if !dimensionsRegexp.MatchString(dimensions) {
+		return "", errors.New(fmt.Sprintf("Preset (%s) has invalid dimensions (%s)", base, dimensions))
+	}
+
+	return dimensions + suffix, nil
+}
+
+// Get the directory slices of the given dimensions are bucketed into.
+// Buckets are always named by the dimensions presets resolve to, so slices
+//   of the same size end up together however they were asked for. Slices
+//   for displays with a scale factor are kept apart from the rest.
+func dimensionsBucket(destination string, intendedDimensions string) (string, error) {
+	dimensions, err := ResolveDimensions(intendedDimensions)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Abs(path.Join(destination, dimensions))
+}
@@ -0,0 +1,160 @@
+package wp
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+// Forget the presets read from the config file, so they're read again.
+func forgetPresets() {
+	presetsOnce = sync.Once{}
+	loadedPresets = nil
+	loadedPresetsErr = nil
+}
+
+// Point the config file at the given path.
+func mockConfigPath(configFile string) func() {
+	f := configPath
+	configPath = func() (string, error) {
+		return configFile, nil
+	}
+	forgetPresets()
+
+	return func() {
+		configPath = f
+		forgetPresets()
+	}
+}
+
+func TestResolveDimensions(t *testing.T) {
+	defer mockConfigPath("/not/a/config.json")()
+
+	for str, expected := range map[string]string{"1920x1080": "1920x1080", "4k": "3840x2160", "Ultrawide-1440": "3440x1440"} {
+		dimensions, err := ResolveDimensions(str)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, dimensions)
+	}
+
+	_, err := ResolveDimensions("vga")
+	assert.Equal(t, "Provided dimension string (vga) is not valid", err.Error())
+}
+
+func TestResolveDimensionsConfig(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	configFile := path.Join(tempDir, "config.json")
+	defer mockConfigPath(configFile)()
+
+	assert.NoError(t, ioutil.WriteFile(configFile, []byte(`{"presets": {"Desk": "5120x1440", "4k": "4096x2160", "broken": "big"}}`), 0644))
+
+	dimensions, err := ResolveDimensions("desk")
+	assert.NoError(t, err)
+	assert.Equal(t, "5120x1440", dimensions)
+
+	dimensions, err = ResolveDimensions("4k")
+	assert.NoError(t, err)
+	assert.Equal(t, "4096x2160", dimensions)
+
+	dimensions, err = ResolveDimensions("1080p")
+	assert.NoError(t, err)
+	assert.Equal(t, "1920x1080", dimensions)
+
+	_, err = ResolveDimensions("broken")
+	assert.Equal(t, "Preset (broken) has invalid dimensions (big)", err.Error())
+
+	assert.NoError(t, ioutil.WriteFile(configFile, []byte(`{"presets": [`), 0644))
+	forgetPresets()
+	_, err = ResolveDimensions("desk")
+	assert.Equal(t, "Failed to read config ("+configFile+"): unexpected end of JSON input", err.Error())
+}
+
+func TestParseDimensionsStringPreset(t *testing.T) {
+	defer mockConfigPath("/not/a/config.json")()
+
+	size, err := ParseDimensionsString("1440p")
+	assert.NoError(t, err)
+	assert.Equal(t, 2560, size.X)
+	assert.Equal(t, 1440, size.Y)
+
+	monitors, err := ParseLayoutString("1440p+0+0,iphone-15-pro-1179+0")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(monitors))
+	assert.Equal(t, 2560, monitors[0].Dx())
+	assert.Equal(t, -1179, monitors[1].Min.X)
+	assert.Equal(t, 2556, monitors[1].Dy())
+}
+
+func TestPickFromImagePreset(t *testing.T) {
+	defer mockConfigPath("/not/a/config.json")()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	is := &ImageSource{LocalPath: path.Join(tempDir, "source.jpg")}
+	err = PickFromImage("720P", tempDir, is, true, "Center", Options{Renderer: renderer, Log: ioutil.Discard})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(renderer.reqs))
+	assert.Equal(t, path.Join(tempDir, "1280x720", "source_scaled_center.jpg"), renderer.reqs[0].OutputPath)
+}
+
+func TestResolveDimensionsScaleFactor(t *testing.T) {
+	defer mockConfigPath("/not/a/config.json")()
+
+	for str, expected := range map[string]string{"1440x900@2x": "1440x900@2x", "1440x900@1x": "1440x900", "4k@2.0x": "3840x2160@2x"} {
+		dimensions, err := ResolveDimensions(str)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, dimensions)
+	}
+
+	_, err := ResolveDimensions("vga@2x")
+	assert.Equal(t, "Provided dimension string (vga@2x) is not valid", err.Error())
+}
+
+func TestPresetsReadOnce(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	configFile := path.Join(tempDir, "config.json")
+	defer mockConfigPath(configFile)()
+
+	reads := 0
+	f := configPath
+	configPath = func() (string, error) {
+		reads++
+		return f()
+	}
+
+	assert.NoError(t, ioutil.WriteFile(configFile, []byte(`{"presets": {"Desk": "5120x1440"}}`), 0644))
+
+	// Dimensions that aren't presets never need the config.
+	dimensions, err := ResolveDimensions("1920x1080@2x")
+	assert.NoError(t, err)
+	assert.Equal(t, "1920x1080@2x", dimensions)
+	assert.Equal(t, 0, reads)
+
+	for i := 0; i < 3; i++ {
+		dimensions, err := ResolveDimensions("desk")
+		assert.NoError(t, err)
+		assert.Equal(t, "5120x1440", dimensions)
+	}
+
+	presets, err := Presets()
+	assert.NoError(t, err)
+	assert.Equal(t, "5120x1440", presets["desk"])
+	assert.Equal(t, "3840x2160", presets["4k"])
+
+	assert.Equal(t, 1, reads)
+}
@@ -0,0 +1,406 @@
+package wp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TIFF tags that hold an image's dimensions, and where its data is.
+const (
+	tiffImageWidthTag      uint16 = 0x0100
+	tiffImageLengthTag     uint16 = 0x0101
+	tiffStripOffsetsTag    uint16 = 0x0111
+	tiffStripByteCountsTag uint16 = 0x0117
+)
+
+// A function that reads the dimensions of an image out of its header.
+// Returns false if the data isn't in a format the prober understands.
+type sizeProber func(r io.ReaderAt) (image.Point, bool)
+
+// Probers for the formats that the standard library can't read the header
+//   of, tried in order after image.DecodeConfig.
+var sizeProbers []sizeProber = []sizeProber{
+	webpSize,
+	bmpSize,
+	tiffSize,
+	isobmffSize,
+}
+
+// A command line tool that can report the dimensions of an image, and how to
+//   ask it for them.
+type identifier struct {
+	binary string
+	args   func(imagePath string) [][]string
+}
+
+// Tools used to measure images that none of the probers understand, in the
+//   same order renderers are preferred in.
+// Each tool may need more than one invocation; the outputs of each are
+//   joined, and should leave the width and height, separated by whitespace.
+var identifiers []identifier = []identifier{
+	{"magick", func(imagePath string) [][]string {
+		return [][]string{{"identify", "-format", "%w %h", imagePath + "[0]"}}
+	}},
+	{"identify", func(imagePath string) [][]string {
+		return [][]string{{"-format", "%w %h", imagePath + "[0]"}}
+	}},
+	{"gm", func(imagePath string) [][]string {
+		return [][]string{{"identify", "-format", "%w %h", imagePath + "[0]"}}
+	}},
+	{"vipsheader", func(imagePath string) [][]string {
+		return [][]string{{"-f", "width", imagePath}, {"-f", "height", imagePath}}
+	}},
+}
+
+// Read the unsigned integer tags requested out of the first IFD of a TIFF
+//   structure.
+// Tags that aren't present, or aren't a single SHORT or LONG, are left out of
+//   the result.
+func readTiffTags(r io.ReaderAt, tags ...uint16) map[uint16]int {
+	values := map[uint16]int{}
+
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return values
+	}
+
+	var order binary.ByteOrder
+	switch string(header[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return values
+	}
+
+	wanted := map[uint16]bool{}
+	for _, tag := range tags {
+		wanted[tag] = true
+	}
+
+	ifdOffset := int64(order.Uint32(header[4:]))
+	count := make([]byte, 2)
+	if _, err := r.ReadAt(count, ifdOffset); err != nil {
+		return values
+	}
+
+	entry := make([]byte, 12)
+	for i := int64(0); i < int64(order.Uint16(count)); i++ {
+		if _, err := r.ReadAt(entry, ifdOffset+2+i*12); err != nil {
+			return values
+		}
+
+		tag := order.Uint16(entry)
+		if !wanted[tag] || order.Uint32(entry[4:]) != 1 {
+			continue
+		}
+
+		switch order.Uint16(entry[2:]) {
+		case 3:
+			values[tag] = int(order.Uint16(entry[8:]))
+		case 4:
+			values[tag] = int(order.Uint32(entry[8:]))
+		}
+	}
+
+	return values
+}
+
+func tiffSize(r io.ReaderAt) (image.Point, bool) {
+	values := readTiffTags(r, tiffImageWidthTag, tiffImageLengthTag)
+	width, hasWidth := values[tiffImageWidthTag]
+	height, hasHeight := values[tiffImageLengthTag]
+	if !hasWidth || !hasHeight {
+		return image.ZP, false
+	}
+
+	return image.Pt(width, height), true
+}
+
+// Read the canvas size of a lossy, lossless, or extended WebP.
+func webpSize(r io.ReaderAt) (image.Point, bool) {
+	header := make([]byte, 30)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return image.ZP, false
+	}
+
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return image.ZP, false
+	}
+
+	data := header[20:]
+	switch string(header[12:16]) {
+	case "VP8 ":
+		if !bytes.Equal(data[3:6], []byte{0x9d, 0x01, 0x2a}) {
+			return image.ZP, false
+		}
+		return image.Pt(
+			int(binary.LittleEndian.Uint16(data[6:])&0x3fff),
+			int(binary.LittleEndian.Uint16(data[8:])&0x3fff),
+		), true
+	case "VP8L":
+		if data[0] != 0x2f {
+			return image.ZP, false
+		}
+		bits := binary.LittleEndian.Uint32(data[1:])
+		return image.Pt(int(bits&0x3fff)+1, int((bits>>14)&0x3fff)+1), true
+	case "VP8X":
+		width := uint32(data[4]) | uint32(data[5])<<8 | uint32(data[6])<<16
+		height := uint32(data[7]) | uint32(data[8])<<8 | uint32(data[9])<<16
+		return image.Pt(int(width)+1, int(height)+1), true
+	}
+
+	return image.ZP, false
+}
+
+// Read the size of a Windows bitmap.
+// Bitmaps stored top-down have a negative height.
+func bmpSize(r io.ReaderAt) (image.Point, bool) {
+	header := make([]byte, 26)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return image.ZP, false
+	}
+
+	if string(header[:2]) != "BM" {
+		return image.ZP, false
+	}
+
+	// OS/2 bitmaps have a smaller header, with 16 bit dimensions.
+	if binary.LittleEndian.Uint32(header[14:]) == 12 {
+		return image.Pt(
+			int(binary.LittleEndian.Uint16(header[18:])),
+			int(binary.LittleEndian.Uint16(header[20:])),
+		), true
+	}
+
+	width := int32(binary.LittleEndian.Uint32(header[18:]))
+	height := int32(binary.LittleEndian.Uint32(header[22:]))
+	if height < 0 {
+		height = -height
+	}
+
+	return image.Pt(int(width), int(height)), true
+}
+
+// A box within an ISO base media file, as used by HEIC and AVIF.
+type isobmffBox struct {
+	boxType string
+	start   int64
+	end     int64
+}
+
+// List the boxes found between start and end.
+func isobmffBoxes(r io.ReaderAt, start int64, end int64) []isobmffBox {
+	var boxes []isobmffBox
+
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			break
+		}
+
+		size := int64(binary.BigEndian.Uint32(header))
+		headerSize := int64(8)
+		if size == 1 {
+			if _, err := r.ReadAt(header[8:], offset+8); err != nil {
+				break
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		} else if size == 0 {
+			size = end - offset
+		}
+
+		if size < headerSize || offset+size > end {
+			break
+		}
+
+		boxes = append(boxes, isobmffBox{string(header[4:8]), offset + headerSize, offset + size})
+		offset += size
+	}
+
+	return boxes
+}
+
+// Find the first box of the given type between start and end.
+func findIsobmffBox(r io.ReaderAt, start int64, end int64, boxType string) (isobmffBox, bool) {
+	for _, box := range isobmffBoxes(r, start, end) {
+		if box.boxType == boxType {
+			return box, true
+		}
+	}
+
+	return isobmffBox{}, false
+}
+
+// Read the size of a HEIC or AVIF image.
+// These formats store a size for every item in the file, including
+//   thumbnails, so the largest is taken to be the primary image. Rotations of
+//   a quarter turn swap the reported dimensions.
+func isobmffSize(r io.ReaderAt) (image.Point, bool) {
+	header := make([]byte, 12)
+	if _, err := r.ReadAt(header, 0); err != nil || string(header[4:8]) != "ftyp" {
+		return image.ZP, false
+	}
+
+	switch string(header[8:12]) {
+	case "heic", "heix", "heim", "heis", "mif1", "msf1", "avif", "avis":
+	default:
+		return image.ZP, false
+	}
+
+	end := int64(1) << 62
+	if f, ok := r.(*os.File); ok {
+		if info, err := f.Stat(); err == nil {
+			end = info.Size()
+		}
+	}
+
+	// meta is a full box, so has a version and flags before its children.
+	meta, ok := findIsobmffBox(r, 0, end, "meta")
+	if !ok {
+		return image.ZP, false
+	}
+	iprp, ok := findIsobmffBox(r, meta.start+4, meta.end, "iprp")
+	if !ok {
+		return image.ZP, false
+	}
+	ipco, ok := findIsobmffBox(r, iprp.start, iprp.end, "ipco")
+	if !ok {
+		return image.ZP, false
+	}
+
+	var size image.Point
+	rotated := false
+	data := make([]byte, 12)
+	for _, box := range isobmffBoxes(r, ipco.start, ipco.end) {
+		switch box.boxType {
+		case "ispe":
+			if _, err := r.ReadAt(data, box.start); err != nil {
+				return image.ZP, false
+			}
+			width := int(binary.BigEndian.Uint32(data[4:]))
+			height := int(binary.BigEndian.Uint32(data[8:]))
+			if width*height > size.X*size.Y {
+				size = image.Pt(width, height)
+			}
+		case "irot":
+			if _, err := r.ReadAt(data[:1], box.start); err != nil {
+				return image.ZP, false
+			}
+			rotated = data[0]&0x03 == 1 || data[0]&0x03 == 3
+		}
+	}
+
+	if size == image.ZP {
+		return image.ZP, false
+	}
+
+	if rotated {
+		size = image.Pt(size.Y, size.X)
+	}
+
+	return size, true
+}
+
+// Ask whichever identifying tool is installed for the image's dimensions.
+func identifySize(imagePath string) (image.Point, bool) {
+	for _, id := range identifiers {
+		if _, err := lookPath(id.binary); err != nil {
+			continue
+		}
+
+		outputs := []string{}
+		for _, args := range id.args(imagePath) {
+			output, err := runCommand(id.binary, args...)
+			if err != nil {
+				return image.ZP, false
+			}
+			outputs = append(outputs, output)
+		}
+
+		fields := strings.Fields(strings.Join(outputs, " "))
+		if len(fields) != 2 {
+			return image.ZP, false
+		}
+
+		width, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return image.ZP, false
+		}
+		height, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return image.ZP, false
+		}
+
+		return image.Pt(width, height), true
+	}
+
+	return image.ZP, false
+}
+
+// Check whether an image the standard library can't decode is shorter than
+//   its own container says it should be.
+// WebP and HEIC/AVIF record the length of everything in them, so are checked
+//   in full; TIFFs are only checked when their data is in a single strip.
+func truncatedImage(r io.ReaderAt, size int64) bool {
+	header := make([]byte, 12)
+	n, _ := r.ReadAt(header, 0)
+	header = header[:n]
+
+	switch sniffImageFormat(header) {
+	case "webp":
+		return int64(binary.LittleEndian.Uint32(header[4:]))+8 > size
+	case "avif", "heic":
+		// Boxes are only listed while they fit within the file, so one that's
+		//   been cut short stops the list before the end.
+		end := int64(0)
+		for _, box := range isobmffBoxes(r, 0, size) {
+			end = box.end
+		}
+		return end+8 <= size
+	case "tiff":
+		values := readTiffTags(r, tiffStripOffsetsTag, tiffStripByteCountsTag)
+		offset, hasOffset := values[tiffStripOffsetsTag]
+		count, hasCount := values[tiffStripByteCountsTag]
+		return hasOffset && hasCount && int64(offset+count) > size
+	}
+
+	return false
+}
+
+// Get the stored dimensions of an image, reading as little of it as
+//   possible.
+// Formats the standard library knows about are read with image.DecodeConfig,
+//   a few others have their headers parsed here, and anything else is handed
+//   to an external tool, if one is installed.
+// Returns image.ErrFormat if nothing could make sense of the image.
+func probeImageSize(imagePath string) (image.Point, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return image.ZP, err
+	}
+	defer f.Close()
+
+	if config, _, err := image.DecodeConfig(f); err == nil {
+		return image.Pt(config.Width, config.Height), nil
+	}
+
+	for _, prober := range sizeProbers {
+		if size, ok := prober(f); ok {
+			return size, nil
+		}
+	}
+
+	if size, ok := identifySize(imagePath); ok {
+		return size, nil
+	}
+
+	return image.ZP, image.ErrFormat
+}
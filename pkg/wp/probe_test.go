@@ -0,0 +1,252 @@
+package wp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func riffWebp(chunk string, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)+12))
+	buf.WriteString("WEBP")
+	buf.WriteString(chunk)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestWebpSize(t *testing.T) {
+	lossy := []byte{0, 0, 0, 0x9d, 0x01, 0x2a, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint16(lossy[6:], 640)
+	binary.LittleEndian.PutUint16(lossy[8:], 480)
+	size, ok := webpSize(bytes.NewReader(riffWebp("VP8 ", lossy)))
+	assert.True(t, ok)
+	assert.Equal(t, image.Pt(640, 480), size)
+
+	lossless := []byte{0x2f, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(lossless[1:], uint32(640-1)|uint32(480-1)<<14)
+	size, ok = webpSize(bytes.NewReader(riffWebp("VP8L", lossless)))
+	assert.True(t, ok)
+	assert.Equal(t, image.Pt(640, 480), size)
+
+	extended := []byte{0, 0, 0, 0, 0x7f, 0x02, 0, 0xdf, 0x01, 0}
+	size, ok = webpSize(bytes.NewReader(riffWebp("VP8X", extended)))
+	assert.True(t, ok)
+	assert.Equal(t, image.Pt(640, 480), size)
+
+	_, ok = webpSize(bytes.NewReader(riffWebp("ALPH", lossy)))
+	assert.False(t, ok)
+}
+
+func TestBmpSize(t *testing.T) {
+	header := make([]byte, 54)
+	copy(header, "BM")
+	binary.LittleEndian.PutUint32(header[14:], 40)
+	binary.LittleEndian.PutUint32(header[18:], 640)
+	binary.LittleEndian.PutUint32(header[22:], uint32(0xffffffff-480+1))
+
+	size, ok := bmpSize(bytes.NewReader(header))
+	assert.True(t, ok)
+	assert.Equal(t, image.Pt(640, 480), size)
+
+	_, ok = bmpSize(bytes.NewReader([]byte("GIF89a")))
+	assert.False(t, ok)
+}
+
+func TestTiffSize(t *testing.T) {
+	var buf bytes.Buffer
+	order := binary.BigEndian
+	buf.WriteString("MM\x00*")
+	binary.Write(&buf, order, uint32(8))
+	binary.Write(&buf, order, uint16(2))
+	binary.Write(&buf, order, []uint16{tiffImageWidthTag, 3, 0, 1, 640, 0})
+	binary.Write(&buf, order, []uint16{tiffImageLengthTag, 4, 0, 1, 0, 480})
+	binary.Write(&buf, order, uint32(0))
+
+	size, ok := tiffSize(bytes.NewReader(buf.Bytes()))
+	assert.True(t, ok)
+	assert.Equal(t, image.Pt(640, 480), size)
+
+	_, ok = tiffSize(bytes.NewReader(orientationTiff(binary.BigEndian, orientationNormal)))
+	assert.False(t, ok)
+}
+
+func isobmffBoxBytes(boxType string, contents ...[]byte) []byte {
+	body := bytes.Join(contents, nil)
+	box := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(box, uint32(8+len(body)))
+	copy(box[4:], boxType)
+	return append(box, body...)
+}
+
+func ispe(width uint32, height uint32) []byte {
+	data := make([]byte, 12)
+	binary.BigEndian.PutUint32(data[4:], width)
+	binary.BigEndian.PutUint32(data[8:], height)
+	return isobmffBoxBytes("ispe", data)
+}
+
+func TestIsobmffSize(t *testing.T) {
+	heic := func(properties ...[]byte) []byte {
+		return bytes.Join([][]byte{
+			isobmffBoxBytes("ftyp", []byte("heic\x00\x00\x00\x00mif1")),
+			isobmffBoxBytes("meta", []byte{0, 0, 0, 0},
+				isobmffBoxBytes("hdlr", make([]byte, 24)),
+				isobmffBoxBytes("iprp", isobmffBoxBytes("ipco", properties...)),
+			),
+			isobmffBoxBytes("mdat"),
+		}, nil)
+	}
+
+	// The thumbnail is ignored in favour of the primary image.
+	size, ok := isobmffSize(bytes.NewReader(heic(ispe(320, 240), ispe(4032, 3024))))
+	assert.True(t, ok)
+	assert.Equal(t, image.Pt(4032, 3024), size)
+
+	size, ok = isobmffSize(bytes.NewReader(heic(ispe(4032, 3024), isobmffBoxBytes("irot", []byte{1}))))
+	assert.True(t, ok)
+	assert.Equal(t, image.Pt(3024, 4032), size)
+
+	_, ok = isobmffSize(bytes.NewReader(heic()))
+	assert.False(t, ok)
+
+	_, ok = isobmffSize(bytes.NewReader(isobmffBoxBytes("ftyp", []byte("isom\x00\x00\x00\x00"))))
+	assert.False(t, ok)
+}
+
+func TestTruncatedImage(t *testing.T) {
+	truncated := func(data []byte) bool {
+		return truncatedImage(bytes.NewReader(data), int64(len(data)))
+	}
+
+	webp := riffWebp("VP8 ", make([]byte, 64))
+	assert.False(t, truncated(webp))
+	assert.True(t, truncated(webp[:40]))
+
+	heic := bytes.Join([][]byte{
+		isobmffBoxBytes("ftyp", []byte("heic\x00\x00\x00\x00mif1")),
+		isobmffBoxBytes("meta", make([]byte, 32)),
+		isobmffBoxBytes("mdat", make([]byte, 64)),
+	}, nil)
+	assert.False(t, truncated(heic))
+	assert.True(t, truncated(heic[:len(heic)-16]))
+
+	var buf bytes.Buffer
+	order := binary.LittleEndian
+	buf.WriteString("II*\x00")
+	binary.Write(&buf, order, uint32(8))
+	binary.Write(&buf, order, uint16(2))
+	binary.Write(&buf, order, []uint16{tiffStripOffsetsTag, 4, 1, 0, 32, 0})
+	binary.Write(&buf, order, []uint16{tiffStripByteCountsTag, 4, 1, 0, 64, 0})
+	binary.Write(&buf, order, uint32(0))
+	buf.Write(make([]byte, 32+64-buf.Len()))
+	tiff := buf.Bytes()
+	assert.False(t, truncated(tiff))
+	assert.True(t, truncated(tiff[:64]))
+
+	assert.False(t, truncated([]byte("GIF89a")))
+}
+
+func TestProbeImageSizeIdentify(t *testing.T) {
+	defer mockInstalled("gm", "vipsheader")()
+
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "640 480\n", nil
+	}
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	imagePath := path.Join(tempDir, "image.jxl")
+	assert.NoError(t, ioutil.WriteFile(imagePath, []byte("not a known format"), 0644))
+
+	size, err := probeImageSize(imagePath)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(640, 480), size)
+	assert.Equal(t, [][]string{{"gm", "identify", "-format", "%w %h", imagePath + "[0]"}}, calls)
+}
+
+func TestProbeImageSizeVipsheader(t *testing.T) {
+	defer mockInstalled("vipsheader")()
+
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	runCommand = func(name string, args ...string) (string, error) {
+		if args[1] == "width" {
+			return "640\n", nil
+		}
+		return "480\n", nil
+	}
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	imagePath := path.Join(tempDir, "image.jxl")
+	assert.NoError(t, ioutil.WriteFile(imagePath, []byte("not a known format"), 0644))
+
+	size, err := probeImageSize(imagePath)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(640, 480), size)
+}
+
+func TestProbeImageSizeUnknown(t *testing.T) {
+	defer mockInstalled("magick")()
+
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	runCommand = func(name string, args ...string) (string, error) {
+		return "identify: no decode delegate", errors.New("exit status 1")
+	}
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	imagePath := path.Join(tempDir, "image.jxl")
+	assert.NoError(t, ioutil.WriteFile(imagePath, []byte("not a known format"), 0644))
+
+	_, err = probeImageSize(imagePath)
+	assert.Equal(t, image.ErrFormat, err)
+}
+
+func TestProbeImageSizeWebp(t *testing.T) {
+	defer mockInstalled()()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	imagePath := path.Join(tempDir, "image.webp")
+	extended := []byte{0, 0, 0, 0, 0x7f, 0x02, 0, 0xdf, 0x01, 0}
+	assert.NoError(t, ioutil.WriteFile(imagePath, riffWebp("VP8X", extended), 0644))
+
+	size, err := GetImageDimensions(imagePath)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(640, 480), size)
+}
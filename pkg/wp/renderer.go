@@ -0,0 +1,244 @@
+package wp
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"os/exec"
+)
+
+// Names of the renderers that can be used to produce image slices.
+const (
+	RendererAuto           string = "auto"
+	RendererImageMagick    string = "convert"
+	RendererImageMagick7   string = "magick"
+	RendererGraphicsMagick string = "gm"
+	RendererVips           string = "vips"
+	RendererNative         string = "native"
+)
+
+// Describes a single slice to be produced from a source image.
+type RenderRequest struct {
+	SourcePath string
+	OutputPath string
+
+	// Where the slice is taken from within the (possibly scaled) source.
+	// If Gravity is empty, the slice's top left corner is placed at Offset
+	//   instead.
+	Gravity string
+	Offset  image.Point
+
+	// Dimensions of the slice to produce.
+	Size image.Point
+
+	// Whether the source should be scaled to cover Size before being cut.
+	Scaled bool
+
+	// Clockwise quarter turn, in degrees, and mirroring, applied to the
+	//   upright source before anything else; see ValidateTransform.
+	// Offsets, gravities, and sizes all refer to the transformed source.
+	Rotate int
+	Flip   string
+
+	// How much closer than just covering Size scaled slices are taken from;
+	//   the source is scaled to cover Size multiplied by Zoom.
+	// Zooms of 1 or less leave the source just covering Size.
+	Zoom float64
+
+	// Size the source is scaled to cover instead of Size, for slices that
+	//   are cut out of a larger region of the source.
+	Cover image.Point
+
+	// How the scaled source is fitted to the slice; one of the Fit*
+	//   constants, and, for contained slices, what fills the rest of it.
+	// Contained slices are placed with Gravity, and ignore Zoom and Cover.
+	Fit  string
+	Fill string
+
+	// How the source is scaled; one of the Filter* constants, and the amount
+	//   it's sharpened by afterwards.
+	// Neither applies to slices that aren't scaled.
+	Filter  string
+	Sharpen float64
+
+	// Quality and compression level of the output, where they apply to the
+	//   format being written; 0 leaves them to the renderer.
+	// The format itself is taken from the extension of OutputPath.
+	Quality     int
+	Compression int
+}
+
+// Get the size a scaled source has to cover.
+func (req RenderRequest) scaleSize() image.Point {
+	size := req.Size
+	if req.Cover != image.ZP {
+		size = req.Cover
+	}
+
+	if req.Zoom <= 1 {
+		return size
+	}
+
+	return image.Pt(
+		int(math.Floor(float64(size.X)*req.Zoom+0.5)),
+		int(math.Floor(float64(size.Y)*req.Zoom+0.5)),
+	)
+}
+
+// Get the size of the image the slice is cut from, given the size of the
+//   source.
+func (req RenderRequest) frame(sourceSize image.Point) image.Point {
+	if !req.Scaled {
+		return sourceSize
+	}
+
+	return scaleToFill(sourceSize, req.scaleSize())
+}
+
+// Get where the top left corner of the slice falls within the (possibly
+//   scaled) source, given the size of it.
+func (req RenderRequest) offset(frame image.Point) (image.Point, error) {
+	if req.Gravity == "" {
+		return req.Offset, nil
+	}
+
+	return gravityOffset(req.Gravity, frame, req.Size)
+}
+
+// A Renderer turns source images into slices.
+type Renderer interface {
+	Render(req RenderRequest) error
+}
+
+// Renderers that can produce many slices of one source image while only
+//   loading and scaling the source once.
+// All requests passed to RenderBatch must share the same SourcePath, Rotate,
+//   and Flip.
+type BatchRenderer interface {
+	Renderer
+	RenderBatch(reqs []RenderRequest) error
+}
+
+// Renderers that can only write slices in some formats.
+type FormatRenderer interface {
+	Renderer
+	CheckFormat(format string) error
+}
+
+type CommandRunner func(name string, args ...string) (string, error)
+
+var runCommand CommandRunner = func(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+var lookPath func(file string) (string, error) = exec.LookPath
+
+// Renderers in the order they're preferred when detecting which tools are
+//   installed.
+// The native renderer isn't listed, since it's always available, and is used
+//   when none of these are.
+var detectableRenderers []string = []string{
+	RendererImageMagick7,
+	RendererImageMagick,
+	RendererGraphicsMagick,
+	RendererVips,
+}
+
+// The binary each command line renderer needs to be available on PATH.
+var rendererBinaries map[string]string = map[string]string{
+	RendererImageMagick:    "convert",
+	RendererImageMagick7:   "magick",
+	RendererGraphicsMagick: "gm",
+	RendererVips:           "vips",
+}
+
+func newRenderer(name string) Renderer {
+	switch name {
+	case RendererImageMagick:
+		return &imageMagickRenderer{[]string{"convert"}}
+	case RendererImageMagick7:
+		return &imageMagickRenderer{[]string{"magick"}}
+	case RendererGraphicsMagick:
+		return &graphicsMagickRenderer{imageMagickRenderer{[]string{"gm", "convert"}}}
+	case RendererVips:
+		return &vipsRenderer{}
+	case RendererNative:
+		return &nativeRenderer{}
+	}
+
+	return nil
+}
+
+// Find the best renderer available on this machine.
+// ImageMagick 7 is preferred over ImageMagick 6, since it also installs a
+//   `convert` compatibility shim, then GraphicsMagick, then libvips.
+// Falls back to the native renderer if none of those tools can be found.
+func DetectRenderer() Renderer {
+	for _, name := range detectableRenderers {
+		if _, err := lookPath(rendererBinaries[name]); err == nil {
+			return newRenderer(name)
+		}
+	}
+
+	return newRenderer(RendererNative)
+}
+
+// Get the renderer with the given name.
+// Command line renderers will fail if the tool they require isn't installed.
+func RendererForName(name string) (Renderer, error) {
+	if name == RendererAuto {
+		return DetectRenderer(), nil
+	}
+
+	renderer := newRenderer(name)
+	if renderer == nil {
+		return nil, errors.New(fmt.Sprintf("Unknown renderer (%s)", name))
+	}
+
+	if binary, ok := rendererBinaries[name]; ok {
+		if _, err := lookPath(binary); err != nil {
+			return nil, errors.New(fmt.Sprintf("Renderer (%s) requires %s, which could not be found", name, binary))
+		}
+	}
+
+	return renderer, nil
+}
+
+// Everything that determines what a scaled copy of a source looks like.
+type scaleKey struct {
+	size    image.Point
+	filter  string
+	sharpen float64
+}
+
+// Split requests into those cut straight from the source, and those cut from
+//   a scaled copy of it.
+// Scaled requests are grouped by how they scale the source, since each group
+//   needs its own scaled copy of the source.
+func partitionRequests(reqs []RenderRequest) ([]RenderRequest, [][]RenderRequest) {
+	var unscaled []RenderRequest
+	var scaled [][]RenderRequest
+
+	groups := map[scaleKey]int{}
+	for _, req := range reqs {
+		if !req.Scaled {
+			unscaled = append(unscaled, req)
+			continue
+		}
+
+		key := scaleKey{req.scaleSize(), req.Filter, req.Sharpen}
+		group, ok := groups[key]
+		if !ok {
+			group = len(scaled)
+			groups[key] = group
+			scaled = append(scaled, nil)
+		}
+
+		scaled[group] = append(scaled[group], req)
+	}
+
+	return unscaled, scaled
+}
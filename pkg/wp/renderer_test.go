@@ -0,0 +1,127 @@
+package wp
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+// Pretend only the provided binaries are installed.
+func mockInstalled(binaries ...string) func() {
+	f := lookPath
+	lookPath = func(file string) (string, error) {
+		for _, binary := range binaries {
+			if binary == file {
+				return "/usr/bin/" + file, nil
+			}
+		}
+
+		return "", errors.New("not found")
+	}
+
+	return func() {
+		lookPath = f
+	}
+}
+
+// A renderer that only records the requests it's given.
+type recordingRenderer struct {
+	reqs []RenderRequest
+}
+
+func (r *recordingRenderer) Render(req RenderRequest) error {
+	r.reqs = append(r.reqs, req)
+	return nil
+}
+
+func TestDetectRendererPrefersImageMagick7(t *testing.T) {
+	defer mockInstalled("convert", "magick", "gm", "vips")()
+
+	assert.Equal(t, &imageMagickRenderer{[]string{"magick"}}, DetectRenderer())
+}
+
+func TestDetectRendererImageMagick6(t *testing.T) {
+	defer mockInstalled("convert", "gm", "vips")()
+
+	assert.Equal(t, &imageMagickRenderer{[]string{"convert"}}, DetectRenderer())
+}
+
+func TestDetectRendererGraphicsMagick(t *testing.T) {
+	defer mockInstalled("gm", "vips")()
+
+	assert.Equal(t, &graphicsMagickRenderer{imageMagickRenderer{[]string{"gm", "convert"}}}, DetectRenderer())
+}
+
+func TestDetectRendererVips(t *testing.T) {
+	defer mockInstalled("vips")()
+
+	assert.Equal(t, &vipsRenderer{}, DetectRenderer())
+}
+
+func TestDetectRendererFallsBackToNative(t *testing.T) {
+	defer mockInstalled()()
+
+	assert.Equal(t, &nativeRenderer{}, DetectRenderer())
+}
+
+func TestRendererForName(t *testing.T) {
+	defer mockInstalled("gm")()
+
+	r, err := RendererForName("gm")
+	assert.NoError(t, err)
+	assert.Equal(t, &graphicsMagickRenderer{imageMagickRenderer{[]string{"gm", "convert"}}}, r)
+
+	r, err = RendererForName("native")
+	assert.NoError(t, err)
+	assert.Equal(t, &nativeRenderer{}, r)
+
+	r, err = RendererForName("auto")
+	assert.NoError(t, err)
+	assert.Equal(t, &graphicsMagickRenderer{imageMagickRenderer{[]string{"gm", "convert"}}}, r)
+}
+
+func TestRendererForNameNotInstalled(t *testing.T) {
+	defer mockInstalled()()
+
+	r, err := RendererForName("vips")
+	assert.Nil(t, r)
+	assert.Equal(t, "Renderer (vips) requires vips, which could not be found", err.Error())
+}
+
+func TestRendererForNameUnknown(t *testing.T) {
+	r, err := RendererForName("paint")
+	assert.Nil(t, r)
+	assert.Equal(t, "Unknown renderer (paint)", err.Error())
+}
+
+func TestPartitionRequests(t *testing.T) {
+	a := RenderRequest{OutputPath: "a", Size: image.Pt(1, 1), Scaled: true}
+	b := RenderRequest{OutputPath: "b", Size: image.Pt(1, 1)}
+	c := RenderRequest{OutputPath: "c", Size: image.Pt(2, 2), Scaled: true}
+	d := RenderRequest{OutputPath: "d", Size: image.Pt(1, 1), Scaled: true}
+	e := RenderRequest{OutputPath: "e", Size: image.Pt(1, 1), Scaled: true, Zoom: 2}
+	f := RenderRequest{OutputPath: "f", Size: image.Pt(2, 2), Scaled: true, Zoom: 1}
+
+	// Zooming into a smaller slice can need the same scaled copy as a larger
+	//   slice does.
+	unscaled, scaled := partitionRequests([]RenderRequest{a, b, c, d, e, f})
+
+	assert.Equal(t, []RenderRequest{b}, unscaled)
+	assert.Equal(t, [][]RenderRequest{{a, d}, {c, e, f}}, scaled)
+}
+
+func TestRenderRequestFrame(t *testing.T) {
+	req := RenderRequest{Size: image.Pt(64, 64)}
+	assert.Equal(t, image.Pt(256, 128), req.frame(image.Pt(256, 128)))
+
+	req.Scaled = true
+	assert.Equal(t, image.Pt(128, 64), req.frame(image.Pt(256, 128)))
+
+	req.Zoom = 1.5
+	assert.Equal(t, image.Pt(96, 96), req.scaleSize())
+	assert.Equal(t, image.Pt(192, 96), req.frame(image.Pt(256, 128)))
+}
@@ -0,0 +1,278 @@
+package wp
+
+import (
+	"image"
+	"math"
+)
+
+// Resampling filters that can be used when scaling slices.
+const (
+	FilterBox        string = "box"
+	FilterTriangle   string = "triangle"
+	FilterCatmullRom string = "catmull-rom"
+	FilterMitchell   string = "mitchell"
+	FilterLanczos    string = "lanczos"
+)
+
+// Sigma of the gaussian blur used to build the unsharp mask when sharpening.
+const sharpenSigma float64 = 1.0
+
+// A resampling kernel, and the distance from its center that it's non-zero
+//   over.
+type kernel struct {
+	support float64
+	at      func(x float64) float64
+}
+
+// Build a cubic BC-spline kernel, as described by Mitchell and Netravali.
+func bcSpline(b float64, c float64) kernel {
+	return kernel{2, func(x float64) float64 {
+		x = math.Abs(x)
+		if x < 1 {
+			return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+		}
+		if x < 2 {
+			return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+		}
+		return 0
+	}}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// Kernels for each filter other than box, which is handled separately, since
+//   it averages source pixels by how much of them are covered, rather than
+//   sampling a kernel.
+var filterKernels map[string]kernel = map[string]kernel{
+	FilterTriangle: kernel{1, func(x float64) float64 {
+		return math.Max(0, 1-math.Abs(x))
+	}},
+	FilterCatmullRom: bcSpline(0, 0.5),
+	FilterMitchell:   bcSpline(1.0/3, 1.0/3),
+	FilterLanczos: kernel{3, func(x float64) float64 {
+		if math.Abs(x) >= 3 {
+			return 0
+		}
+		return sinc(x) * sinc(x/3)
+	}},
+}
+
+// A single source pixel's share of an output pixel.
+type contribution struct {
+	index  int
+	weight float64
+}
+
+// Work out which source pixels contribute to each output pixel when
+//   stretching a row of srcLen pixels to dstLen pixels.
+// Each output pixel is the area-weighted average of the source pixels it
+//   covers, which is what ImageMagick's `-scale` does.
+func boxContributions(srcLen int, dstLen int) [][]contribution {
+	scale := float64(srcLen) / float64(dstLen)
+	contributions := make([][]contribution, dstLen)
+
+	for i := range contributions {
+		start := float64(i) * scale
+		end := start + scale
+
+		total := 0.0
+		for j := int(start); float64(j) < end && j < srcLen; j++ {
+			coverage := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if coverage <= 0 {
+				continue
+			}
+
+			contributions[i] = append(contributions[i], contribution{j, coverage})
+			total += coverage
+		}
+
+		for j := range contributions[i] {
+			contributions[i][j].weight /= total
+		}
+	}
+
+	return contributions
+}
+
+// Work out which source pixels contribute to each output pixel when
+//   stretching a row of srcLen pixels to dstLen pixels by sampling the
+//   provided kernel.
+// When shrinking, the kernel is widened to cover every source pixel that
+//   falls within the output pixel. Pixels past the edges are clamped to the
+//   nearest edge pixel.
+func kernelContributions(k kernel, srcLen int, dstLen int) [][]contribution {
+	scale := float64(srcLen) / float64(dstLen)
+	filterScale := math.Max(scale, 1)
+	support := k.support * filterScale
+
+	contributions := make([][]contribution, dstLen)
+	for i := range contributions {
+		center := (float64(i)+0.5)*scale - 0.5
+		start := int(math.Ceil(center - support))
+		end := int(math.Floor(center + support))
+
+		weights := map[int]float64{}
+		order := []int{}
+		total := 0.0
+		for j := start; j <= end; j++ {
+			weight := k.at((float64(j) - center) / filterScale)
+			if weight == 0 {
+				continue
+			}
+
+			index := j
+			if index < 0 {
+				index = 0
+			} else if index >= srcLen {
+				index = srcLen - 1
+			}
+
+			if _, ok := weights[index]; !ok {
+				order = append(order, index)
+			}
+			weights[index] += weight
+			total += weight
+		}
+
+		for _, index := range order {
+			contributions[i] = append(contributions[i], contribution{index, weights[index] / total})
+		}
+	}
+
+	return contributions
+}
+
+func filterContributions(filter string, srcLen int, dstLen int) [][]contribution {
+	if k, ok := filterKernels[filter]; ok {
+		return kernelContributions(k, srcLen, dstLen)
+	}
+
+	return boxContributions(srcLen, dstLen)
+}
+
+func clampChannel(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// Write the weighted sum of RGBA pixels into dst.
+// Kernels with negative lobes can overshoot, so colour channels are kept
+//   within alpha to leave a valid premultiplied pixel.
+func writePixel(dst []uint8, r, g, b, a float64) {
+	dst[3] = clampChannel(a)
+	alpha := float64(dst[3])
+	dst[0] = clampChannel(math.Min(r, alpha))
+	dst[1] = clampChannel(math.Min(g, alpha))
+	dst[2] = clampChannel(math.Min(b, alpha))
+}
+
+// Run the horizontal and vertical contributions over the source image.
+// Runs as two separable passes; horizontal first, then vertical.
+func convolve(src *image.RGBA, size image.Point, horizontal [][]contribution, vertical [][]contribution) *image.RGBA {
+	srcSize := src.Bounds().Size()
+
+	// Horizontal pass, producing an image that's the target width, but the
+	//   source's height.
+	intermediate := image.NewRGBA(image.Rect(0, 0, size.X, srcSize.Y))
+	for y := 0; y < srcSize.Y; y++ {
+		srcRow := src.Pix[y*src.Stride:]
+		dstRow := intermediate.Pix[y*intermediate.Stride:]
+		for x, contributions := range horizontal {
+			var r, g, b, a float64
+			for _, c := range contributions {
+				p := srcRow[c.index*4 : c.index*4+4]
+				r += float64(p[0]) * c.weight
+				g += float64(p[1]) * c.weight
+				b += float64(p[2]) * c.weight
+				a += float64(p[3]) * c.weight
+			}
+			writePixel(dstRow[x*4:], r, g, b, a)
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	for y, contributions := range vertical {
+		dstRow := dst.Pix[y*dst.Stride:]
+		for x := 0; x < size.X; x++ {
+			var r, g, b, a float64
+			for _, c := range contributions {
+				p := intermediate.Pix[c.index*intermediate.Stride+x*4:]
+				r += float64(p[0]) * c.weight
+				g += float64(p[1]) * c.weight
+				b += float64(p[2]) * c.weight
+				a += float64(p[3]) * c.weight
+			}
+			writePixel(dstRow[x*4:], r, g, b, a)
+		}
+	}
+
+	return dst
+}
+
+// Resample the provided image to exactly the given size, using the named
+//   filter.
+// Box, the default, is a plain area average that matches ImageMagick's
+//   `-scale`, rather than a windowed kernel; only the other filters sample
+//   one of filterKernels.
+func resample(src *image.RGBA, size image.Point, filter string) *image.RGBA {
+	srcSize := src.Bounds().Size()
+	if srcSize == size {
+		return src
+	}
+
+	horizontal := filterContributions(filter, srcSize.X, size.X)
+	vertical := filterContributions(filter, srcSize.Y, size.Y)
+	return convolve(src, size, horizontal, vertical)
+}
+
+// Get the contributions of a normalized gaussian blur over a row of length
+//   pixels.
+func gaussianContributions(sigma float64, length int) [][]contribution {
+	k := kernel{math.Ceil(3 * sigma), func(x float64) float64 {
+		return math.Exp(-(x * x) / (2 * sigma * sigma))
+	}}
+
+	return kernelContributions(k, length, length)
+}
+
+// Sharpen the image with an unsharp mask; each pixel is pushed away from a
+//   blurred copy of itself by the given amount.
+func sharpen(src *image.RGBA, amount float64) *image.RGBA {
+	if amount <= 0 {
+		return src
+	}
+
+	size := src.Bounds().Size()
+	blurred := convolve(
+		src,
+		size,
+		gaussianContributions(sharpenSigma, size.X),
+		gaussianContributions(sharpenSigma, size.Y),
+	)
+
+	dst := image.NewRGBA(src.Bounds())
+	for i := 0; i < len(src.Pix); i += 4 {
+		s := src.Pix[i : i+4]
+		b := blurred.Pix[i : i+4]
+		writePixel(
+			dst.Pix[i:],
+			float64(s[0])+amount*(float64(s[0])-float64(b[0])),
+			float64(s[1])+amount*(float64(s[1])-float64(b[1])),
+			float64(s[2])+amount*(float64(s[2])-float64(b[2])),
+			float64(s[3]),
+		)
+	}
+
+	return dst
+}
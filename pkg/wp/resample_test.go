@@ -0,0 +1,110 @@
+package wp
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoxContributionsDownscale(t *testing.T) {
+	contributions := boxContributions(3, 2)
+
+	assert.Equal(t, []contribution{{0, 1.0 / 1.5}, {1, 0.5 / 1.5}}, contributions[0])
+	assert.Equal(t, []contribution{{1, 0.5 / 1.5}, {2, 1.0 / 1.5}}, contributions[1])
+}
+
+func TestBoxContributionsUpscale(t *testing.T) {
+	contributions := boxContributions(1, 3)
+
+	for _, c := range contributions {
+		assert.Equal(t, []contribution{{0, 1}}, c)
+	}
+}
+
+func TestResampleAveragesPixels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.Set(0, 0, color.RGBA{255, 255, 255, 255})
+	src.Set(1, 0, color.RGBA{0, 0, 0, 255})
+	src.Set(0, 1, color.RGBA{255, 255, 255, 255})
+	src.Set(1, 1, color.RGBA{0, 0, 0, 255})
+
+	dst := resample(src, image.Pt(1, 1), FilterBox)
+
+	assert.Equal(t, image.Rect(0, 0, 1, 1), dst.Bounds())
+	assert.Equal(t, color.RGBA{128, 128, 128, 255}, dst.RGBAAt(0, 0))
+}
+
+func TestResampleSameSize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	assert.True(t, src == resample(src, image.Pt(2, 2), FilterLanczos))
+}
+
+func TestKernelContributionsNormalized(t *testing.T) {
+	for filter, k := range filterKernels {
+		for _, contributions := range kernelContributions(k, 100, 37) {
+			total := 0.0
+			for _, c := range contributions {
+				total += c.weight
+				assert.True(t, c.index >= 0 && c.index < 100, filter)
+			}
+			assert.InDelta(t, 1, total, 1e-9, filter)
+		}
+	}
+}
+
+func TestKernelContributionsClampEdges(t *testing.T) {
+	contributions := kernelContributions(filterKernels[FilterTriangle], 4, 2)
+
+	assert.Equal(t, []contribution{{0, 1.0 / 2}, {1, 3.0 / 8}, {2, 1.0 / 8}}, contributions[0])
+}
+
+func TestKernels(t *testing.T) {
+	for filter, k := range filterKernels {
+		assert.InDelta(t, 0, k.at(k.support), 1e-9, filter)
+	}
+
+	assert.InDelta(t, 1, filterKernels[FilterTriangle].at(0), 1e-9)
+	assert.InDelta(t, 1, filterKernels[FilterCatmullRom].at(0), 1e-9)
+	assert.InDelta(t, 8.0/9, filterKernels[FilterMitchell].at(0), 1e-9)
+	assert.InDelta(t, 1, filterKernels[FilterLanczos].at(0), 1e-9)
+}
+
+func TestResampleWithKernelKeepsFlatColour(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 10, 6))
+	for i := range src.Pix {
+		src.Pix[i] = 200
+	}
+
+	for filter := range filterKernels {
+		dst := resample(src, image.Pt(4, 3), filter)
+		assert.Equal(t, image.Rect(0, 0, 4, 3), dst.Bounds())
+		for _, p := range dst.Pix {
+			assert.Equal(t, uint8(200), p, filter)
+		}
+	}
+}
+
+func TestSharpen(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	src.Set(0, 0, color.RGBA{100, 100, 100, 255})
+	src.Set(1, 0, color.RGBA{100, 100, 100, 255})
+	src.Set(2, 0, color.RGBA{150, 150, 150, 255})
+	src.Set(3, 0, color.RGBA{150, 150, 150, 255})
+
+	dst := sharpen(src, 1)
+
+	assert.True(t, dst.RGBAAt(1, 0).R < 100)
+	assert.True(t, dst.RGBAAt(2, 0).R > 150)
+	assert.Equal(t, uint8(255), dst.RGBAAt(2, 0).A)
+}
+
+func TestSharpenNone(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	assert.True(t, src == sharpen(src, 0))
+}
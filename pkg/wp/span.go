@@ -0,0 +1,128 @@
+package wp
+
+import (
+	"fmt"
+	"image"
+	"os"
+)
+
+// Get the smallest rectangle that covers every monitor.
+func layoutBounds(monitors []image.Rectangle) image.Rectangle {
+	bounds := monitors[0]
+	for _, monitor := range monitors[1:] {
+		bounds = bounds.Union(monitor)
+	}
+
+	return bounds
+}
+
+// Get the name of the slice for the monitor at the given index of a layout.
+func monitorSliceName(gravity string, monitor int) string {
+	return fmt.Sprintf("%s_monitor%d", gravity, monitor+1)
+}
+
+// Build the requests for one slice per monitor, each cut out of the region
+//   of the source the whole layout covers when placed with the given gravity.
+// Slices are named for the gravity and the monitor, counting from 1.
+func monitorRequests(sourcePath string, sourceSize image.Point, monitors []image.Rectangle, scaled bool, zoom float64, gravity string, destination string, opts Options) ([]RenderRequest, error) {
+	bounds := layoutBounds(monitors)
+	size := bounds.Size()
+
+	region, err := placeRequest(RenderRequest{
+		SourcePath: sourcePath,
+		Gravity:    gravity,
+		Size:       size,
+		Scaled:     scaled,
+		Rotate:     opts.Rotate,
+		Flip:       opts.Flip,
+		Zoom:       zoom,
+	}, opts.renderer())
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := region.offset(region.frame(sourceSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var reqs []RenderRequest
+	for i, monitor := range monitors {
+		outputPath := GetOutputFilename(destination, opts.sliceName(monitorSliceName(gravity, i)), scaled, zoom, sourcePath, opts.Format)
+
+		fmt.Fprintln(opts.log(), outputPath)
+
+		if _, err := os.Stat(outputPath); err == nil {
+			continue
+		}
+
+		reqs = append(reqs, RenderRequest{
+			SourcePath:  sourcePath,
+			OutputPath:  outputPath,
+			Offset:      offset.Add(monitor.Min.Sub(bounds.Min)),
+			Size:        monitor.Size(),
+			Scaled:      scaled,
+			Rotate:      opts.Rotate,
+			Flip:        opts.Flip,
+			Zoom:        zoom,
+			Cover:       size,
+			Filter:      opts.Filter,
+			Sharpen:     opts.Sharpen,
+			Quality:     opts.Quality,
+			Compression: opts.Compression,
+		})
+	}
+
+	return reqs, nil
+}
+
+/*
+  Cut one slice per monitor out of a single region of the source, so that
+  the image continues across all of the monitors in the layout.
+  The region covering the whole layout is placed on the source the same way
+  PickFromImage places a slice, including any zoom levels, and slices are
+  bucketed by the size of the whole layout.
+*/
+func SpanFromImage(layout string, destination string, imageSource *ImageSource, scaled bool, gravity string, opts Options) error {
+	monitors, err := ParseLayoutString(layout)
+	if err != nil {
+		return err
+	}
+
+	size := layoutBounds(monitors).Size()
+
+	destination, err = dimensionsBucket(destination, fmt.Sprintf("%dx%d", size.X, size.Y))
+	if err != nil {
+		return err
+	}
+
+	if err = osMkdirp(destination, 0755); err != nil {
+		return err
+	}
+
+	sourcePath := imageSource.LocalPath
+	sourceSize, err := GetImageDimensions(sourcePath)
+	if err != nil {
+		return err
+	}
+
+	sourceSize = rotatedSize(sourceSize, opts.Rotate)
+
+	zooms := []float64{0}
+	if len(opts.Zoom) > 0 {
+		scaled = true
+		zooms = opts.Zoom
+	}
+
+	var reqs []RenderRequest
+	for _, zoom := range zooms {
+		zoomReqs, err := monitorRequests(sourcePath, sourceSize, monitors, scaled, zoom, gravity, destination, opts)
+		if err != nil {
+			return err
+		}
+
+		reqs = append(reqs, zoomReqs...)
+	}
+
+	return renderRequests(opts.renderer(), reqs)
+}
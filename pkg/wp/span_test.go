@@ -0,0 +1,128 @@
+package wp
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayoutBounds(t *testing.T) {
+	bounds := layoutBounds([]image.Rectangle{
+		image.Rect(0, 0, 2560, 1440),
+		image.Rect(2560, -240, 3640, 1680),
+	})
+	assert.Equal(t, image.Rect(0, -240, 3640, 1680), bounds)
+}
+
+func TestSpanFromImage(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	is := &ImageSource{LocalPath: sourceImage}
+
+	// The layout covers 96x64, which the 256x128 source is scaled to 128x64
+	//   to cover.
+	err = SpanFromImage("64x32+0+16,32x64+64+0", tempDir, is, true, "East", Options{Renderer: renderer, Log: ioutil.Discard})
+	assert.NoError(t, err)
+
+	outputDir := path.Join(tempDir, "96x64")
+	assert.Equal(t, []RenderRequest{
+		{
+			SourcePath: sourceImage,
+			OutputPath: path.Join(outputDir, "wide_scaled_east_monitor1.jpg"),
+			Offset:     image.Pt(32, 16),
+			Size:       image.Pt(64, 32),
+			Scaled:     true,
+			Cover:      image.Pt(96, 64),
+		},
+		{
+			SourcePath: sourceImage,
+			OutputPath: path.Join(outputDir, "wide_scaled_east_monitor2.jpg"),
+			Offset:     image.Pt(96, 0),
+			Size:       image.Pt(32, 64),
+			Scaled:     true,
+			Cover:      image.Pt(96, 64),
+		},
+	}, renderer.reqs)
+
+	for _, req := range renderer.reqs {
+		assert.Equal(t, image.Pt(128, 64), req.frame(image.Pt(256, 128)))
+	}
+}
+
+func TestSpanFromImageUnscaled(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	is := &ImageSource{LocalPath: sourceImage}
+
+	err = SpanFromImage("32x32+0+0,32x32+32+0", tempDir, is, false, "SouthEast", Options{Renderer: renderer, Log: ioutil.Discard})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(renderer.reqs))
+	assert.Equal(t, image.Pt(64, 96), renderer.reqs[0].Offset)
+	assert.Equal(t, image.Pt(96, 96), renderer.reqs[1].Offset)
+	assert.Equal(t, path.Join(tempDir, "64x32", "square_southeast_monitor1.jpg"), renderer.reqs[0].OutputPath)
+}
+
+func TestSpanFromImageZoom(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	is := &ImageSource{LocalPath: sourceImage}
+
+	// Zoomed regions are always scaled, even when the layout isn't.
+	err = SpanFromImage("32x32+0+0,32x32+32+0", tempDir, is, false, "Center", Options{Renderer: renderer, Log: ioutil.Discard, Zoom: []float64{2}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(renderer.reqs))
+	for i, req := range renderer.reqs {
+		assert.True(t, req.Scaled)
+		assert.Equal(t, 2.0, req.Zoom)
+		assert.Equal(t, path.Join(tempDir, "64x32", fmt.Sprintf("wide_scaled_2x_center_monitor%d.jpg", i+1)), req.OutputPath)
+	}
+}
+
+func TestSpanFromImageBadGravity(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	is := &ImageSource{LocalPath: sourceImage}
+	err = SpanFromImage("32x32+0+0", tempDir, is, false, "Up", Options{Renderer: &recordingRenderer{}, Log: ioutil.Discard})
+	assert.Equal(t, "Unknown gravity (Up)", err.Error())
+}
@@ -0,0 +1,74 @@
+package wp
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+)
+
+// Get the positions of tiles of the given length needed to cover a line of
+//   the given length, with each tile overlapping its neighbours by at least
+//   the given percentage.
+// Tiles are spread evenly from one end to the other, so the first and last
+//   tiles line up with the ends, and overlaps may be larger than asked for.
+func tilePositions(length int, tile int, overlap float64) []int {
+	free := length - tile
+	if free <= 0 {
+		return []int{0}
+	}
+
+	step := math.Max(1, math.Floor(float64(tile)*(1-overlap/100)))
+	count := int(math.Ceil(float64(free)/step)) + 1
+
+	positions := make([]int, count)
+	for i := range positions {
+		positions[i] = int(math.Floor(float64(i*free)/float64(count-1) + 0.5))
+	}
+
+	return positions
+}
+
+/*
+  Cut the source into a grid of tiles of the intended dimensions at its own
+  scale, covering every part of it.
+  Tiles are named by their row and column, counting from 1 at the top left.
+*/
+func TileFromLocalImage(intendedDimensions string, destination string, localPath string, opts Options) error {
+	desiredSize, imageSize, destinationDirComplete, err := prepareSliceBucket(intendedDimensions, destination, localPath, 1, opts.Rotate)
+	if err != nil {
+		return err
+	}
+
+	rows := tilePositions(imageSize.Y, desiredSize.Y, opts.Overlap)
+	columns := tilePositions(imageSize.X, desiredSize.X, opts.Overlap)
+
+	// Pad the row and column numbers so that tiles sort in order.
+	format := fmt.Sprintf("tile_r%%0%dd_c%%0%dd", len(strconv.Itoa(len(rows))), len(strconv.Itoa(len(columns))))
+
+	var gravities []string
+	offsets := map[string]image.Point{}
+	for row, y := range rows {
+		for column, x := range columns {
+			name := fmt.Sprintf(format, row+1, column+1)
+			gravities = append(gravities, name)
+			offsets[name] = image.Pt(x, y)
+		}
+	}
+
+	reqs, err := gravityRequests(localPath, false, 0, gravities, desiredSize, destinationDirComplete, opts)
+	if err != nil {
+		return err
+	}
+
+	for i := range reqs {
+		reqs[i].Offset = offsets[reqs[i].Gravity]
+		reqs[i].Gravity = ""
+	}
+
+	return renderRequests(opts.renderer(), reqs)
+}
+
+func TileFromImage(intendedDimensions string, destination string, imageSource *ImageSource, opts Options) error {
+	return TileFromLocalImage(intendedDimensions, destination, imageSource.LocalPath, opts)
+}
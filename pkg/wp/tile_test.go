@@ -0,0 +1,61 @@
+package wp
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTilePositions(t *testing.T) {
+	assert.Equal(t, []int{0}, tilePositions(64, 64, 0))
+	assert.Equal(t, []int{0, 64}, tilePositions(128, 64, 0))
+	assert.Equal(t, []int{0, 32, 64}, tilePositions(128, 64, 50))
+
+	// Tiles that don't divide the length evenly overlap more than asked.
+	assert.Equal(t, []int{0, 75, 150}, tilePositions(250, 100, 0))
+	assert.Equal(t, []int{0, 50, 100}, tilePositions(200, 100, 40))
+}
+
+func TestTileFromLocalImage(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	err = TileFromLocalImage("64x64", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard, Overlap: 50})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3*7, len(renderer.reqs))
+
+	first := renderer.reqs[0]
+	assert.Equal(t, path.Join(tempDir, "64x64", "wide_tile_r1_c1.jpg"), first.OutputPath)
+	assert.Equal(t, image.Pt(0, 0), first.Offset)
+	assert.Equal(t, "", first.Gravity)
+	assert.False(t, first.Scaled)
+
+	last := renderer.reqs[len(renderer.reqs)-1]
+	assert.Equal(t, path.Join(tempDir, "64x64", "wide_tile_r3_c7.jpg"), last.OutputPath)
+	assert.Equal(t, image.Pt(192, 64), last.Offset)
+}
+
+func TestTileFromLocalImageTooSmall(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	err = TileFromLocalImage("64x256", "/tmp", sourceImage, Options{Renderer: &recordingRenderer{}, Log: ioutil.Discard})
+	assert.Equal(t, "Image (wide.jpg) is not tall enough to produce quality 64x256 output", err.Error())
+}
@@ -0,0 +1,105 @@
+package wp
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strconv"
+)
+
+// Directions a source can be mirrored in before it's sliced.
+const (
+	FlipHorizontal string = "h"
+	FlipVertical   string = "v"
+)
+
+// Check that the rotation is a quarter turn, and that the flip is understood.
+// Rotations are clockwise, in degrees, and are applied before flips.
+func ValidateTransform(rotate int, flip string) error {
+	if rotate != 0 && rotate != 90 && rotate != 180 && rotate != 270 {
+		return errors.New(fmt.Sprintf("Provided rotation (%d) must be one of 0, 90, 180, or 270", rotate))
+	}
+
+	if flip != "" && flip != FlipHorizontal && flip != FlipVertical {
+		return errors.New(fmt.Sprintf("Unknown flip (%s)", flip))
+	}
+
+	return nil
+}
+
+// Get the size a source of the given size has once it's been rotated.
+func rotatedSize(size image.Point, rotate int) image.Point {
+	if rotate == 90 || rotate == 270 {
+		return image.Pt(size.Y, size.X)
+	}
+
+	return size
+}
+
+// Get the EXIF orientations that apply the rotation and the flip, in the
+//   order they need to be applied.
+func transformOrientations(rotate int, flip string) []int {
+	var orientations []int
+	switch rotate {
+	case 90:
+		orientations = append(orientations, orientationRotate90)
+	case 180:
+		orientations = append(orientations, orientationRotate180)
+	case 270:
+		orientations = append(orientations, orientationRotate270)
+	}
+
+	switch flip {
+	case FlipHorizontal:
+		orientations = append(orientations, orientationFlipH)
+	case FlipVertical:
+		orientations = append(orientations, orientationFlipV)
+	}
+
+	return orientations
+}
+
+// Rotate and flip an upright image.
+func transformImage(img *image.RGBA, rotate int, flip string) *image.RGBA {
+	for _, orientation := range transformOrientations(rotate, flip) {
+		img = orientImage(img, orientation)
+	}
+
+	return img
+}
+
+// Get the part of a slice's name that describes how its source was
+//   transformed, like rot90_fliph_; empty if it wasn't.
+func transformTag(rotate int, flip string) string {
+	tag := ""
+	if rotate != 0 {
+		tag += "rot" + strconv.Itoa(rotate) + "_"
+	}
+
+	if flip != "" {
+		tag += "flip" + flip + "_"
+	}
+
+	return tag
+}
+
+// Get the size of the request's source, once it's been upright and
+//   transformed.
+func (req RenderRequest) sourceSize() (image.Point, error) {
+	size, err := GetImageDimensions(req.SourcePath)
+	if err != nil {
+		return image.ZP, err
+	}
+
+	return rotatedSize(size, req.Rotate), nil
+}
+
+// Decode the request's source, upright and transformed.
+func (req RenderRequest) decodeSource() (*image.RGBA, error) {
+	img, err := decodeImage(req.SourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return transformImage(img, req.Rotate, req.Flip), nil
+}
@@ -0,0 +1,55 @@
+package wp
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTransform(t *testing.T) {
+	assert.NoError(t, ValidateTransform(0, ""))
+	assert.NoError(t, ValidateTransform(90, FlipHorizontal))
+	assert.NoError(t, ValidateTransform(270, FlipVertical))
+
+	assert.Equal(t, "Provided rotation (45) must be one of 0, 90, 180, or 270", ValidateTransform(45, "").Error())
+	assert.Equal(t, "Provided rotation (-90) must be one of 0, 90, 180, or 270", ValidateTransform(-90, "").Error())
+	assert.Equal(t, "Unknown flip (x)", ValidateTransform(0, "x").Error())
+}
+
+func TestRotatedSize(t *testing.T) {
+	assert.Equal(t, image.Pt(64, 32), rotatedSize(image.Pt(64, 32), 0))
+	assert.Equal(t, image.Pt(32, 64), rotatedSize(image.Pt(64, 32), 90))
+	assert.Equal(t, image.Pt(64, 32), rotatedSize(image.Pt(64, 32), 180))
+	assert.Equal(t, image.Pt(32, 64), rotatedSize(image.Pt(64, 32), 270))
+}
+
+func TestTransformTag(t *testing.T) {
+	assert.Equal(t, "", transformTag(0, ""))
+	assert.Equal(t, "rot90_", transformTag(90, ""))
+	assert.Equal(t, "fliph_", transformTag(0, FlipHorizontal))
+	assert.Equal(t, "rot270_flipv_", transformTag(270, FlipVertical))
+}
+
+func TestTransformImage(t *testing.T) {
+	// A 2x1 image, red on the left.
+	red := color.RGBA{255, 0, 0, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, red)
+
+	rotated := transformImage(img, 90, "")
+	assert.Equal(t, image.Pt(1, 2), rotated.Bounds().Size())
+	assert.Equal(t, red, rotated.RGBAAt(0, 0))
+
+	// Rotating puts red at the top, and flipping afterwards moves it back to
+	//   the bottom.
+	flipped := transformImage(img, 90, FlipVertical)
+	assert.Equal(t, image.Pt(1, 2), flipped.Bounds().Size())
+	assert.Equal(t, red, flipped.RGBAAt(0, 1))
+
+	assert.Equal(t, red, transformImage(img, 0, FlipHorizontal).RGBAAt(1, 0))
+	assert.Equal(t, red, transformImage(img, 180, "").RGBAAt(1, 0))
+}
@@ -9,21 +9,109 @@ import (
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"math"
 	"os"
-	"os/exec"
 	"path"
-	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 )
 
-type ImageMagickRunner func(args ...string) (string, error)
+// Options controlling how image slices are produced.
+// The zero value renders slices with whichever renderer DetectRenderer finds,
+//   and reports the paths of slices to stderr.
+type Options struct {
+	Renderer Renderer
+	Log      io.Writer
+
+	// Filter used to scale slices, and how much to sharpen them afterwards.
+	Filter  string
+	Sharpen float64
+
+	// Format to write slices in; one of the Format* constants.
+	// Slices are written in the source's format if not set.
+	Format string
+
+	// Quality of lossy output, from 1 to 100, and compression level of PNG
+	//   output, from 1 to 9.
+	// Renderer defaults are used for either if not set.
+	Quality     int
+	Compression int
+
+	// Whether extracting an image also produces scaled and unscaled slices
+	//   placed over the most interesting part of it.
+	Auto bool
+
+	// Number of evenly spaced scaled slices to take along the long axis of
+	//   images whose aspect ratio differs from the slices'; 0 uses the
+	//   standard three gravities.
+	Steps int
+
+	// Zoom levels scaled slices are taken at, in addition to just covering
+	//   the slice; see RenderRequest.Zoom.
+	// Picking a slice with zoom levels set always scales the source.
+	Zoom []float64
+
+	// Smallest percentage of each tile that overlaps with its neighbours when
+	//   tiling an image.
+	Overlap float64
+
+	// How scaled slices fit their source; one of the Fit* constants.
+	// Scaled slices cover the slice if not set. Contained slices fill the
+	//   area the source doesn't cover with Fill; either a colour, or one of
+	//   the Fill* constants.
+	Fit  string
+	Fill string
+
+	// How much scaled slices may enlarge images smaller than the slices when
+	//   extracting them, like 1.1 for 10%; 0 or 1 never enlarges them.
+	// Unscaled slices of those images are skipped.
+	MaxUpscale float64
+
+	// Most pixels scaled slices can move from the center of an image before
+	//   extracting it takes more than just the centered slice; slices that
+	//   can only move this far all look the same.
+	DuplicateTolerance int
+
+	// Clockwise rotation, in degrees, and flip applied to sources before
+	//   they're sliced; see ValidateTransform.
+	// Slices of transformed sources are named after the transform, so they
+	//   don't collide with slices of the source as it is.
+	Rotate int
+	Flip   string
+}
+
+func (o Options) renderer() Renderer {
+	if o.Renderer == nil {
+		return DetectRenderer()
+	}
+
+	return o.Renderer
+}
+
+func (o Options) maxUpscale() float64 {
+	return math.Max(1, o.MaxUpscale)
+}
+
+// Get the name a slice placed with the given gravity is given, once any
+//   transform is accounted for.
+func (o Options) sliceName(gravity string) string {
+	return transformTag(o.Rotate, o.Flip) + gravity
+}
 
-const imagemagickBin string = "convert"
+func (o Options) log() io.Writer {
+	if o.Log == nil {
+		return os.Stderr
+	}
+
+	return o.Log
+}
 
 var dimensionsRegexp *regexp.Regexp = regexp.MustCompile(`^(\d+)x(\d+)$`)
-var epsilon float64 = math.Nextafter(1, 2) - 1
+var scaleFactorRegexp *regexp.Regexp = regexp.MustCompile(`^(.+)@([\d.]+)x$`)
+var layoutRegexp *regexp.Regexp = regexp.MustCompile(`^(.+?)([+-]\d+)([+-]\d+)$`)
 
 // Gravity sets:
 var equalAspectRatioGravities []string = []string{
@@ -51,45 +139,44 @@ var unscaledGravities []string = []string{
 	"Center",
 }
 
-var doImageMagick ImageMagickRunner = func(args ...string) (string, error) {
-	cmd := exec.Command(imagemagickBin, args...)
-	output, err := cmd.CombinedOutput()
-	return string(output), err
-}
-
 // Get the dimensions of an image at the path passed in.
+// Only the image's header is read where possible; see probeImageSize.
 func GetImageDimensions(imagePath string) (image.Point, error) {
-	sourceImage, err := os.Open(imagePath)
+	imageSize, err := probeImageSize(imagePath)
 	if err != nil {
 		return image.ZP, err
 	}
 
-	img, _, err := image.Decode(sourceImage)
+	// Sources are cropped as they're displayed, so report the dimensions the
+	//   image has once its EXIF orientation has been applied.
+	orientation, err := readOrientation(imagePath)
 	if err != nil {
 		return image.ZP, err
 	}
 
-	imageBoundingRect := img.Bounds()
-	imageOrigin := imageBoundingRect.Min
-	imageSize := imageBoundingRect.Max
-	if imageOrigin.X != 0 || imageOrigin.Y != 0 {
-		return image.ZP, errors.New("Don't know how to deal with non-origin-point images")
+	if orientationSwapsAxes(orientation) {
+		imageSize = image.Pt(imageSize.Y, imageSize.X)
 	}
 
 	return imageSize, nil
 }
 
 // Get the final output filename of writing an image with the given parameters.
-func GetOutputFilename(outputDir string, gravity string, scaled bool, sourcePath string) string {
+// Output keeps the source's extension, unless a format is provided. Scaled
+//   slices taken at a zoom greater than 1 include the zoom in their name.
+func GetOutputFilename(outputDir string, gravity string, scaled bool, zoom float64, sourcePath string, format string) string {
 	sourceImageBasename := path.Base(sourcePath)
 	sourceImageExtension := path.Ext(sourcePath)
 	destImagePrefix := sourceImageBasename[:len(sourceImageBasename)-len(sourceImageExtension)]
+	destImageExtension := outputExtension(sourcePath, format)
 
 	var outputFilename string
-	if scaled {
-		outputFilename = destImagePrefix + "_scaled_" + strings.ToLower(gravity) + sourceImageExtension
+	if scaled && zoom > 1 {
+		outputFilename = destImagePrefix + "_scaled_" + zoomString(zoom) + "_" + strings.ToLower(gravity) + destImageExtension
+	} else if scaled {
+		outputFilename = destImagePrefix + "_scaled_" + strings.ToLower(gravity) + destImageExtension
 	} else {
-		outputFilename = destImagePrefix + "_" + strings.ToLower(gravity) + sourceImageExtension
+		outputFilename = destImagePrefix + "_" + strings.ToLower(gravity) + destImageExtension
 	}
 	return path.Join(outputDir, outputFilename)
 }
@@ -106,47 +193,149 @@ func osMkdirp(p string, mode os.FileMode) error {
 	return nil
 }
 
-/*
-  Run imagemagick against the provided source path and generate crops or
-  rescales of the image.
-*/
-func ExtractGravitiesFromLocalImage(
-	sourcePath string,
-	scaled bool,
-	gravities []string,
-	dimensions string,
-	output string,
-) error {
-	var errs []error
+// Build the requests needed to produce the given gravities of a source.
+// Each output path is reported as it's planned; outputs that already exist
+//   are reported, but not requested again.
+// Automatic gravities and fractional positions are resolved to a fixed
+//   offset here, so renderers only ever see gravities they understand.
+// Contained slices are named apart from scaled ones, and are never zoomed.
+func gravityRequests(sourcePath string, scaled bool, zoom float64, gravities []string, size image.Point, output string, opts Options) ([]RenderRequest, error) {
+	contained := scaled && opts.Fit == FitContain
+	if contained {
+		zoom = 0
+	}
+
+	var reqs []RenderRequest
 	for _, gravity := range gravities {
-		outputPath := GetOutputFilename(output, gravity, scaled, sourcePath)
+		outputPath := GetOutputFilename(output, opts.sliceName(gravity), scaled, zoom, sourcePath, opts.Format)
+		if contained {
+			outputPath = GetOutputFilename(output, "contained_"+opts.sliceName(gravity), false, 0, sourcePath, opts.Format)
+		}
+
+		fmt.Fprintln(opts.log(), outputPath)
 
 		if _, err := os.Stat(outputPath); err == nil {
-			fmt.Fprintln(os.Stderr, outputPath)
 			continue
 		}
 
-		imagemagickArgs := []string{
-			sourcePath,
-			"-gravity", gravity,
-			"-extent", dimensions,
-			outputPath,
+		req := RenderRequest{
+			SourcePath:  sourcePath,
+			OutputPath:  outputPath,
+			Gravity:     gravity,
+			Size:        size,
+			Scaled:      scaled,
+			Rotate:      opts.Rotate,
+			Flip:        opts.Flip,
+			Zoom:        zoom,
+			Fit:         opts.Fit,
+			Fill:        opts.Fill,
+			Filter:      opts.Filter,
+			Sharpen:     opts.Sharpen,
+			Quality:     opts.Quality,
+			Compression: opts.Compression,
 		}
 
-		if scaled {
-			scaledArgs := []string{"-scale", dimensions + "^"}
-			imagemagickArgs = append(imagemagickArgs[:3], append(scaledArgs, imagemagickArgs[3:]...)...)
+		req, err := placeRequest(req, opts.renderer())
+		if err != nil {
+			return nil, err
 		}
 
-		fmt.Fprintln(os.Stderr, outputPath)
+		reqs = append(reqs, req)
+	}
+
+	return reqs, nil
+}
 
-		output, err := doImageMagick(imagemagickArgs...)
+// Replace an automatic gravity or fractional position with the offset it
+//   places the slice at.
+// Contained slices cover their whole source, so can only be placed with a
+//   gravity.
+// Automatic placements analyse a copy of the source made by the renderer.
+func placeRequest(req RenderRequest, renderer Renderer) (RenderRequest, error) {
+	if _, ok := ParsePosition(req.Gravity); req.contained() && (ok || IsAutoGravity(req.Gravity)) {
+		return req, errors.New(fmt.Sprintf("Gravity (%s) can't be used to place contained slices", req.Gravity))
+	}
 
+	if IsAutoGravity(req.Gravity) {
+		offset, err := autoOffset(req, renderer)
 		if err != nil {
-			errs = append(errs, errors.New(output))
-			errs = append(errs, err)
+			return req, err
+		}
+
+		req.Gravity = ""
+		req.Offset = offset
+	} else if position, ok := ParsePosition(req.Gravity); ok {
+		sourceSize, err := req.sourceSize()
+		if err != nil {
+			return req, err
+		}
+
+		req.Gravity = ""
+		req.Offset = positionOffset(position, req.frame(sourceSize), req.Size)
+	}
+
+	return req, nil
+}
+
+// Locks held while an output path is being rendered, so that sources that
+//   share a name, being processed at once, don't both write the same slices.
+var outputPathLocks sync.Map
+
+// Lock the output paths of all of the requests, in a fixed order so that
+//   batches sharing some of them can't deadlock one another.
+func lockOutputPaths(reqs []RenderRequest) func() {
+	var paths []string
+	seen := map[string]bool{}
+	for _, req := range reqs {
+		if !seen[req.OutputPath] {
+			seen[req.OutputPath] = true
+			paths = append(paths, req.OutputPath)
+		}
+	}
+
+	sort.Strings(paths)
+
+	var mutexes []*sync.Mutex
+	for _, outputPath := range paths {
+		lock, _ := outputPathLocks.LoadOrStore(outputPath, &sync.Mutex{})
+		mutex := lock.(*sync.Mutex)
+		mutex.Lock()
+		mutexes = append(mutexes, mutex)
+	}
+
+	return func() {
+		for _, mutex := range mutexes {
+			mutex.Unlock()
+		}
+	}
+}
+
+// Render all of the provided requests, which must share a source image and
+//   the transform applied to it.
+// Renderers that can produce many slices at once get all of the requests
+//   together, so that the source is only loaded once.
+// Outputs that were written by another source with the same name since the
+//   requests were built are left alone.
+func renderRequests(renderer Renderer, reqs []RenderRequest) error {
+	unlock := lockOutputPaths(reqs)
+	defer unlock()
+
+	var pending []RenderRequest
+	for _, req := range reqs {
+		if _, err := os.Stat(req.OutputPath); err != nil {
+			pending = append(pending, req)
 		}
 	}
+	reqs = pending
+
+	if batchRenderer, ok := renderer.(BatchRenderer); ok && len(reqs) > 1 {
+		return batchRenderer.RenderBatch(reqs)
+	}
+
+	var errs []error
+	for _, req := range reqs {
+		errs = append(errs, renderer.Render(req))
+	}
 
 	if err := MultiErrorFromErrors(errs); err.Exists() {
 		return err
@@ -155,80 +344,326 @@ func ExtractGravitiesFromLocalImage(
 	return nil
 }
 
-func ExtractFromLocalImage(intendedDimensions string, destination string, localPath string) error {
+/*
+  Run the selected renderer against the provided source path and generate
+  crops or rescales of the image.
+  Scaled slices are produced at each of the zoom levels in the options, if
+  there are any, unless they contain their source.
+*/
+func ExtractGravitiesFromLocalImage(
+	sourcePath string,
+	scaled bool,
+	gravities []string,
+	dimensions string,
+	output string,
+	opts Options,
+) error {
+	size, err := ParseDimensionsString(dimensions)
+	if err != nil {
+		return err
+	}
+
+	zooms := []float64{0}
+	if scaled && len(opts.Zoom) > 0 && opts.Fit != FitContain {
+		zooms = opts.Zoom
+	}
+
+	var reqs []RenderRequest
+	for _, zoom := range zooms {
+		zoomReqs, err := gravityRequests(sourcePath, scaled, zoom, gravities, size, output, opts)
+		if err != nil {
+			return err
+		}
+
+		reqs = append(reqs, zoomReqs...)
+	}
+
+	return renderRequests(opts.renderer(), reqs)
+}
+
+// Check that an image of the given size is large enough to cover the desired
+//   size once enlarged by at most maxUpscale.
+// Errors name the bucket the slices would have gone in, so that dimensions
+//   that only differ by their scale factor can be told apart.
+func checkImageSize(localPath string, bucket string, imageSize image.Point, desiredSize image.Point, maxUpscale float64) error {
+	if float64(imageSize.X)*maxUpscale < float64(desiredSize.X) {
+		return errors.New(fmt.Sprintf("Image (%s) is not wide enough to produce quality %s output", path.Base(localPath), path.Base(bucket)))
+	}
+
+	if float64(imageSize.Y)*maxUpscale < float64(desiredSize.Y) {
+		return errors.New(fmt.Sprintf("Image (%s) is not tall enough to produce quality %s output", path.Base(localPath), path.Base(bucket)))
+	}
+
+	return nil
+}
+
+// Check that the image is large enough to cut slices of the intended
+//   dimensions out of once rotated, and enlarged by at most maxUpscale, and
+//   create the directory those slices are bucketed into.
+// Returns the size of the slices, the size of the rotated image, and the
+//   directory.
+func prepareSliceBucket(intendedDimensions string, destination string, localPath string, maxUpscale float64, rotate int) (image.Point, image.Point, string, error) {
 	// Check to make sure the passed in output dimensions are valid before
 	//   creating the directory.
 	desiredSize, err := ParseDimensionsString(intendedDimensions)
 	if err != nil {
-		return err
+		return image.ZP, image.ZP, "", err
 	}
 
 	imageSize, err := GetImageDimensions(localPath)
 	if err != nil {
-		return err
+		return image.ZP, image.ZP, "", err
 	}
 
-	if imageSize.X < desiredSize.X {
-		return errors.New(fmt.Sprintf("Image (%s) is not wide enough to produce quality output", path.Base(localPath)))
+	destinationDirComplete, err := dimensionsBucket(destination, intendedDimensions)
+	if err != nil {
+		return image.ZP, image.ZP, "", err
 	}
 
-	if imageSize.Y < desiredSize.Y {
-		return errors.New(fmt.Sprintf("Image (%s) is not tall enough to produce quality output", path.Base(localPath)))
+	imageSize = rotatedSize(imageSize, rotate)
+	if err := checkImageSize(localPath, destinationDirComplete, imageSize, desiredSize, maxUpscale); err != nil {
+		return image.ZP, image.ZP, "", err
 	}
 
-	destinationDirComplete, err := filepath.Abs(path.Join(destination, intendedDimensions))
+	if err := osMkdirp(destinationDirComplete, 0755); err != nil {
+		return image.ZP, image.ZP, "", err
+	}
+
+	return desiredSize, imageSize, destinationDirComplete, nil
+}
+
+func ExtractFromLocalImage(intendedDimensions string, destination string, localPath string, opts Options) error {
+	// Contained slices can be made from sources of any size or shape, and
+	//   since each one shows the whole source, only one is needed.
+	if opts.Fit == FitContain {
+		if _, err := ParseDimensionsString(intendedDimensions); err != nil {
+			return err
+		}
+
+		destinationDirComplete, err := dimensionsBucket(destination, intendedDimensions)
+		if err != nil {
+			return err
+		}
+
+		if err := osMkdirp(destinationDirComplete, 0755); err != nil {
+			return err
+		}
+
+		return ExtractGravitiesFromLocalImage(localPath, true, equalAspectRatioGravities, intendedDimensions, destinationDirComplete, opts)
+	}
+
+	desiredSize, imageSize, destinationDirComplete, err := prepareSliceBucket(intendedDimensions, destination, localPath, opts.maxUpscale(), opts.Rotate)
 	if err != nil {
 		return err
 	}
 
-	if err := osMkdirp(destinationDirComplete, 0755); err != nil {
+	scaledGravities, skipped := chooseScaledGravities(imageSize, desiredSize, opts)
+
+	var duplicates []string
+	for _, gravity := range skipped {
+		duplicates = append(duplicates, GetOutputFilename(destinationDirComplete, opts.sliceName(gravity), true, 0, localPath, opts.Format))
+	}
+
+	unscaled := unscaledGravities
+	if opts.Auto {
+		scaledGravities = append(append([]string{}, scaledGravities...), GravityAuto)
+		unscaled = append(append([]string{}, unscaled...), GravityAuto)
+	}
+
+	// When the scaled slices don't need the image resized at all, unscaled
+	//   slices in the same place as a scaled one come out identical to it.
+	// Filters other than box still resample at the image's own size, like
+	//   ImageMagick's -resize does, so slices made with them aren't identical.
+	distinctUnscaled := unscaled
+	boxFiltered := opts.Filter == "" || opts.Filter == FilterBox
+	if scaleToFill(imageSize, desiredSize) == imageSize && opts.Sharpen <= 0 && boxFiltered {
+		duplicated, err := duplicateGravities(localPath, scaledGravities, unscaled, desiredSize, imageSize, opts)
+		if err != nil {
+			return err
+		}
+
+		distinctUnscaled = nil
+		for _, gravity := range unscaled {
+			if duplicated[gravity] {
+				duplicates = append(duplicates, GetOutputFilename(destinationDirComplete, opts.sliceName(gravity), false, 0, localPath, opts.Format))
+			} else {
+				distinctUnscaled = append(distinctUnscaled, gravity)
+			}
+		}
+	}
+
+	// Everything is rendered together, so that renderers that support it
+	//   only need to load the source image once.
+	reqs, err := gravityRequests(localPath, true, 0, scaledGravities, desiredSize, destinationDirComplete, opts)
+	if err != nil {
 		return err
 	}
 
-	// Check aspect ratio to know which direction scaled images will be
-	//   sliced.
-	// There will be a lot of duplicates without this step.
-	desiredAspectRatio := float64(imageSize.X) / float64(imageSize.Y)
-	imageAspectRatio := float64(desiredSize.X) / float64(desiredSize.Y)
+	// Images smaller than the slices are only let through when they can be
+	//   enlarged by little enough, so report which slices were.
+	upscale := upscaleFactor(imageSize, desiredSize)
+	softErrs := []error{upscaledError(localPath, upscale, reqs), duplicatesError(localPath, duplicates)}
+
+	// Zoomed slices have room to move in both directions, so are taken with
+	//   every gravity.
+	// Zoom levels that would need the source enlarged by more than allowed
+	//   are skipped, and reported the same way images that are too small are.
+	for _, zoom := range opts.Zoom {
+		if zoom <= 1 {
+			continue
+		}
+
+		if float64(imageSize.X)*opts.maxUpscale() < float64(desiredSize.X)*zoom {
+			softErrs = append(softErrs, errors.New(fmt.Sprintf("Image (%s) is not wide enough to produce quality %s output at %s zoom", path.Base(localPath), path.Base(destinationDirComplete), zoomString(zoom))))
+			continue
+		}
 
-	var scaledGravities []string = nil
-	if math.Abs(desiredAspectRatio-imageAspectRatio) < epsilon {
-		scaledGravities = equalAspectRatioGravities
-	} else if desiredAspectRatio > imageAspectRatio {
-		scaledGravities = wideAspectRatioGravities
+		if float64(imageSize.Y)*opts.maxUpscale() < float64(desiredSize.Y)*zoom {
+			softErrs = append(softErrs, errors.New(fmt.Sprintf("Image (%s) is not tall enough to produce quality %s output at %s zoom", path.Base(localPath), path.Base(destinationDirComplete), zoomString(zoom))))
+			continue
+		}
+
+		zoomReqs, err := gravityRequests(localPath, true, zoom, unscaled, desiredSize, destinationDirComplete, opts)
+		if err != nil {
+			return err
+		}
+
+		softErrs = append(softErrs, upscaledError(localPath, upscale*zoom, zoomReqs))
+		reqs = append(reqs, zoomReqs...)
+	}
+
+	// Unscaled slices can't be enlarged at all, so are skipped for images
+	//   that are too small.
+	var unscaledReqs []RenderRequest
+	if imageSize.X < desiredSize.X {
+		softErrs = append(softErrs, errors.New(fmt.Sprintf("Image (%s) is not wide enough to produce quality unscaled %s output", path.Base(localPath), path.Base(destinationDirComplete))))
+	} else if imageSize.Y < desiredSize.Y {
+		softErrs = append(softErrs, errors.New(fmt.Sprintf("Image (%s) is not tall enough to produce quality unscaled %s output", path.Base(localPath), path.Base(destinationDirComplete))))
 	} else {
-		scaledGravities = tallAspectRatioGravities
-	}
-
-	err1 := ExtractGravitiesFromLocalImage(
-		localPath,
-		true,
-		scaledGravities,
-		intendedDimensions,
-		destinationDirComplete,
-	)
-
-	err2 := ExtractGravitiesFromLocalImage(
-		localPath,
-		false,
-		unscaledGravities,
-		intendedDimensions,
-		destinationDirComplete,
-	)
-
-	if err := MultiErrorFromErrors([]error{err1, err2}); err.Exists() {
+		unscaledReqs, err = gravityRequests(localPath, false, 0, distinctUnscaled, desiredSize, destinationDirComplete, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	renderErr := renderRequests(opts.renderer(), append(reqs, unscaledReqs...))
+	if err := MultiErrorFromErrors(append(softErrs, renderErr)); err.Exists() {
 		return err
 	}
 
 	return nil
 }
 
-func ExtractFromImage(intendedDimensions string, destination string, imageSource *ImageSource) error {
-	return ExtractFromLocalImage(intendedDimensions, destination, imageSource.LocalPath)
+// Get the gravities scaled slices of an image are taken with, and the ones
+//   skipped for producing the same slice as the centered one.
+// Scaled slices travel along whichever axis of the scaled image is longer
+//   than the slices; there will be a lot of duplicates without this step.
+func chooseScaledGravities(imageSize image.Point, desiredSize image.Point, opts Options) ([]string, []string) {
+	travel := scaleToFill(imageSize, desiredSize).Sub(desiredSize)
+
+	var gravities []string = nil
+	if opts.Steps > 0 {
+		gravities = stepPositions(opts.Steps)
+	} else if travel.X > travel.Y {
+		gravities = wideAspectRatioGravities
+	} else {
+		gravities = tallAspectRatioGravities
+	}
+
+	// Scaled slices that can barely move look the same wherever they're
+	//   placed, so only the centered one is taken.
+	// Images with exactly the slices' aspect ratio only ever had the one.
+	if maxInt(travel.X, travel.Y) > opts.DuplicateTolerance {
+		return gravities, nil
+	}
+
+	var skipped []string
+	if travel != image.ZP {
+		for _, gravity := range gravities {
+			if gravity != "Center" {
+				skipped = append(skipped, gravity)
+			}
+		}
+	}
+
+	return equalAspectRatioGravities, skipped
 }
 
-func PickFromImage(intendedDimensions string, destination string, imageSource *ImageSource, scaled bool, gravity string) error {
-	destination, err := filepath.Abs(path.Join(destination, intendedDimensions))
+// Describe the slices that had to be cut from a copy of the image enlarged by
+//   the given factor, if it was enlarged at all.
+// Slices are all in the same bucket, which is named so that dimensions that
+//   only differ by their scale factor can be told apart.
+func upscaledError(localPath string, factor float64, reqs []RenderRequest) error {
+	if factor <= 1 || len(reqs) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(reqs))
+	for i, req := range reqs {
+		names[i] = path.Base(req.OutputPath)
+	}
+
+	bucket := path.Base(path.Dir(reqs[0].OutputPath))
+	return errors.New(fmt.Sprintf("Image (%s) was upscaled %.2fx to produce %s in %s", path.Base(localPath), factor, strings.Join(names, ", "), bucket))
+}
+
+// Describe the slices that were skipped for duplicating others, if any were.
+// Slices are all in the same bucket, like they are for upscaledError.
+func duplicatesError(localPath string, duplicates []string) error {
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(duplicates))
+	for i, duplicate := range duplicates {
+		names[i] = path.Base(duplicate)
+	}
+
+	bucket := path.Base(path.Dir(duplicates[0]))
+	return errors.New(fmt.Sprintf("Image (%s) would produce duplicate slices in %s, skipped %s", path.Base(localPath), bucket, strings.Join(names, ", ")))
+}
+
+// Find the unscaled gravities that place a slice where one of the scaled
+//   gravities does, for an image that scaled slices don't resize.
+func duplicateGravities(sourcePath string, scaled []string, unscaled []string, size image.Point, sourceSize image.Point, opts Options) (map[string]bool, error) {
+	offset := func(gravity string, scaled bool) (image.Point, error) {
+		req, err := placeRequest(RenderRequest{SourcePath: sourcePath, Gravity: gravity, Size: size, Scaled: scaled, Rotate: opts.Rotate, Flip: opts.Flip}, opts.renderer())
+		if err != nil {
+			return image.ZP, err
+		}
+
+		return req.offset(req.frame(sourceSize))
+	}
+
+	scaledOffsets := map[image.Point]bool{}
+	for _, gravity := range scaled {
+		o, err := offset(gravity, true)
+		if err != nil {
+			return nil, err
+		}
+
+		scaledOffsets[o] = true
+	}
+
+	duplicated := map[string]bool{}
+	for _, gravity := range unscaled {
+		o, err := offset(gravity, false)
+		if err != nil {
+			return nil, err
+		}
+
+		duplicated[gravity] = scaledOffsets[o]
+	}
+
+	return duplicated, nil
+}
+
+func ExtractFromImage(intendedDimensions string, destination string, imageSource *ImageSource, opts Options) error {
+	return ExtractFromLocalImage(intendedDimensions, destination, imageSource.LocalPath, opts)
+}
+
+func PickFromImage(intendedDimensions string, destination string, imageSource *ImageSource, scaled bool, gravity string, opts Options) error {
+	destination, err := dimensionsBucket(destination, intendedDimensions)
 	if err != nil {
 		return err
 	}
@@ -237,5 +672,9 @@ func PickFromImage(intendedDimensions string, destination string, imageSource *I
 		return err
 	}
 
-	return ExtractGravitiesFromLocalImage(imageSource.LocalPath, scaled, []string{gravity}, intendedDimensions, destination)
+	if len(opts.Zoom) > 0 || opts.Fit == FitContain {
+		scaled = true
+	}
+
+	return ExtractGravitiesFromLocalImage(imageSource.LocalPath, scaled, []string{gravity}, intendedDimensions, destination, opts)
 }
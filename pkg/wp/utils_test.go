@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -14,6 +15,21 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+var imageMagickOptions Options = Options{Renderer: newRenderer(RendererImageMagick)}
+
+func concatArgs(args ...[]string) []string {
+	var rv []string
+	for _, a := range args {
+		rv = append(rv, a...)
+	}
+	return rv
+}
+
+// The arguments ImageMagick is given to cut a slice out of a batch.
+func batchCropArgs(gravity string, dimensions string, outputPath string) []string {
+	return []string{"(", "+clone", "-gravity", gravity, "-extent", dimensions, "-write", outputPath, "+delete", ")"}
+}
+
 func TestGetImageDimensions(t *testing.T) {
 	cwd, _ := os.Getwd()
 	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
@@ -25,6 +41,20 @@ func TestGetImageDimensions(t *testing.T) {
 	assert.Equal(t, dims, image.Point{128, 128})
 }
 
+func TestGetImageDimensionsRotated(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	sourceImage := path.Join(tempDir, "rotated.jpg")
+	writeOrientedJpeg(t, sourceImage, image.Pt(64, 32), orientationRotate90)
+
+	dims, err := GetImageDimensions(sourceImage)
+	assert.NoError(t, err)
+
+	assert.Equal(t, dims, image.Point{32, 64})
+}
+
 func TestGetImageDimensionsNotFound(t *testing.T) {
 	cwd, _ := os.Getwd()
 	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "not-an-image.jpg"))
@@ -40,6 +70,8 @@ func TestGetImageDimensionsNotFound(t *testing.T) {
 }
 
 func TestGetImageDimensionsNotImage(t *testing.T) {
+	defer mockInstalled()()
+
 	cwd, _ := os.Getwd()
 	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images"))
 	assert.NoError(t, err)
@@ -51,11 +83,23 @@ func TestGetImageDimensionsNotImage(t *testing.T) {
 }
 
 func TestGetOutputFilename(t *testing.T) {
-	p := GetOutputFilename("/some/path", "north", false, "image.jpg")
+	p := GetOutputFilename("/some/path", "north", false, 0, "image.jpg", "")
 	assert.Equal(t, "/some/path/image_north.jpg", p)
 
-	p = GetOutputFilename("./some/path", "south", true, "image.png")
+	p = GetOutputFilename("./some/path", "south", true, 0, "image.png", "")
 	assert.Equal(t, "some/path/image_scaled_south.png", p)
+
+	p = GetOutputFilename("./some/path", "south", true, 0, "image.png", FormatWebP)
+	assert.Equal(t, "some/path/image_scaled_south.webp", p)
+
+	p = GetOutputFilename("./some/path", "east", false, 0, "image.png", FormatJPEG)
+	assert.Equal(t, "some/path/image_east.jpg", p)
+
+	p = GetOutputFilename("./some/path", "east", true, 1.5, "image.png", "")
+	assert.Equal(t, "some/path/image_scaled_1.5x_east.png", p)
+
+	p = GetOutputFilename("./some/path", "east", true, 1, "image.png", "")
+	assert.Equal(t, "some/path/image_scaled_east.png", p)
 }
 
 func TestOsMkdirp(t *testing.T) {
@@ -89,39 +133,41 @@ func TestOsMkdirpFailsTooNested(t *testing.T) {
 }
 
 func TestExtractGravitiesFromLocalImageScaled(t *testing.T) {
-	f := doImageMagick
+	f := runCommand
 	defer func() {
-		doImageMagick = f
+		runCommand = f
 	}()
 
-	doImageMagick = func(args ...string) (string, error) {
-		assert.Equal(t, []string{"abc", "-gravity", "Center", "-scale", "64x64^", "-extent", "64x64", "images/abc_scaled_center"}, args)
+	runCommand = func(name string, args ...string) (string, error) {
+		assert.Equal(t, "convert", name)
+		assert.Equal(t, []string{"abc", "-auto-orient", "-gravity", "Center", "-scale", "64x64^", "-extent", "64x64", "images/abc_scaled_center"}, args)
 		return "", nil
 	}
 
-	err := ExtractGravitiesFromLocalImage("abc", true, []string{"Center"}, "64x64", "images")
+	err := ExtractGravitiesFromLocalImage("abc", true, []string{"Center"}, "64x64", "images", imageMagickOptions)
 	assert.NoError(t, err)
 }
 
 func TestExtractGravitiesFromLocalImageUnscaled(t *testing.T) {
-	f := doImageMagick
+	f := runCommand
 	defer func() {
-		doImageMagick = f
+		runCommand = f
 	}()
 
-	doImageMagick = func(args ...string) (string, error) {
-		assert.Equal(t, []string{"abc", "-gravity", "Center", "-extent", "64x64", "images/abc_center"}, args)
+	runCommand = func(name string, args ...string) (string, error) {
+		assert.Equal(t, "convert", name)
+		assert.Equal(t, []string{"abc", "-auto-orient", "-gravity", "Center", "-extent", "64x64", "images/abc_center"}, args)
 		return "", nil
 	}
 
-	err := ExtractGravitiesFromLocalImage("abc", false, []string{"Center"}, "64x64", "images")
+	err := ExtractGravitiesFromLocalImage("abc", false, []string{"Center"}, "64x64", "images", imageMagickOptions)
 	assert.NoError(t, err)
 }
 
 func TestExtractGravitiesFromLocalImageAlreadyExists(t *testing.T) {
-	f := doImageMagick
+	f := runCommand
 	defer func() {
-		doImageMagick = f
+		runCommand = f
 	}()
 
 	tempDir, err := ioutil.TempDir("", "")
@@ -133,19 +179,19 @@ func TestExtractGravitiesFromLocalImageAlreadyExists(t *testing.T) {
 	_, err = os.Create(outputPath)
 	assert.NoError(t, err)
 
-	doImageMagick = func(args ...string) (string, error) {
+	runCommand = func(name string, args ...string) (string, error) {
 		assert.Fail(t, "Imagemagick should not be called in this test")
 		return "", nil
 	}
 
-	err = ExtractGravitiesFromLocalImage("abc", false, []string{"Center"}, "64x64", tempDir)
+	err = ExtractGravitiesFromLocalImage("abc", false, []string{"Center"}, "64x64", tempDir, imageMagickOptions)
 	assert.NoError(t, err)
 }
 
 func TestExtractFromLocalImageSameAspectRatio(t *testing.T) {
-	f := doImageMagick
+	f := runCommand
 	defer func() {
-		doImageMagick = f
+		runCommand = f
 	}()
 
 	cwd, err := os.Getwd()
@@ -162,22 +208,30 @@ func TestExtractFromLocalImageSameAspectRatio(t *testing.T) {
 	assert.NoError(t, err)
 
 	expectedCalls := [][]string{
-		[]string{sourceImage, "-gravity", "Center", "-scale", "64x64^", "-extent", "64x64", path.Join(outputDir, "square_scaled_center.jpg")},
-		[]string{sourceImage, "-gravity", "North", "-extent", "64x64", path.Join(outputDir, "square_north.jpg")},
-		[]string{sourceImage, "-gravity", "NorthEast", "-extent", "64x64", path.Join(outputDir, "square_northeast.jpg")},
-		[]string{sourceImage, "-gravity", "East", "-extent", "64x64", path.Join(outputDir, "square_east.jpg")},
-		[]string{sourceImage, "-gravity", "SouthEast", "-extent", "64x64", path.Join(outputDir, "square_southeast.jpg")},
-		[]string{sourceImage, "-gravity", "South", "-extent", "64x64", path.Join(outputDir, "square_south.jpg")},
-		[]string{sourceImage, "-gravity", "SouthWest", "-extent", "64x64", path.Join(outputDir, "square_southwest.jpg")},
-		[]string{sourceImage, "-gravity", "West", "-extent", "64x64", path.Join(outputDir, "square_west.jpg")},
-		[]string{sourceImage, "-gravity", "NorthWest", "-extent", "64x64", path.Join(outputDir, "square_northwest.jpg")},
-		[]string{sourceImage, "-gravity", "Center", "-extent", "64x64", path.Join(outputDir, "square_center.jpg")},
+		concatArgs(
+			[]string{sourceImage, "-auto-orient"},
+			[]string{"(", "+clone", "-scale", "64x64^"},
+			batchCropArgs("Center", "64x64", path.Join(outputDir, "square_scaled_center.jpg")),
+			[]string{"+delete", ")"},
+			batchCropArgs("North", "64x64", path.Join(outputDir, "square_north.jpg")),
+			batchCropArgs("NorthEast", "64x64", path.Join(outputDir, "square_northeast.jpg")),
+			batchCropArgs("East", "64x64", path.Join(outputDir, "square_east.jpg")),
+			batchCropArgs("SouthEast", "64x64", path.Join(outputDir, "square_southeast.jpg")),
+			batchCropArgs("South", "64x64", path.Join(outputDir, "square_south.jpg")),
+			batchCropArgs("SouthWest", "64x64", path.Join(outputDir, "square_southwest.jpg")),
+			batchCropArgs("West", "64x64", path.Join(outputDir, "square_west.jpg")),
+			batchCropArgs("NorthWest", "64x64", path.Join(outputDir, "square_northwest.jpg")),
+			batchCropArgs("Center", "64x64", path.Join(outputDir, "square_center.jpg")),
+			[]string{"null:"},
+		),
 	}
 
-	doImageMagick = func(args ...string) (string, error) {
+	runCommand = func(name string, args ...string) (string, error) {
+		assert.Equal(t, "convert", name)
+
 		// Fail now, rather than assert. Assert will continue, and crash at [0]
 		if len(expectedCalls) == 0 {
-			fmt.Fprintln(os.Stderr, "doImageMagick called when not expected")
+			fmt.Fprintln(os.Stderr, "runCommand called when not expected")
 			t.FailNow()
 		}
 
@@ -186,16 +240,296 @@ func TestExtractFromLocalImageSameAspectRatio(t *testing.T) {
 		return "", nil
 	}
 
-	err = ExtractFromLocalImage("64x64", tempDir, sourceImage)
+	err = ExtractFromLocalImage("64x64", tempDir, sourceImage, imageMagickOptions)
 	assert.NoError(t, err)
 
 	assert.Equal(t, 0, len(expectedCalls))
 }
 
+func TestExtractFromLocalImageSteps(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	err = ExtractFromLocalImage("64x64", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard, Steps: 3})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3+len(unscaledGravities), len(renderer.reqs))
+	for i, expected := range []struct {
+		name   string
+		offset image.Point
+	}{{"0", image.Pt(0, 0)}, {"0.5", image.Pt(32, 0)}, {"1", image.Pt(64, 0)}} {
+		req := renderer.reqs[i]
+		assert.Equal(t, path.Join(tempDir, "64x64", "wide_scaled_"+expected.name+".jpg"), req.OutputPath)
+		assert.Equal(t, "", req.Gravity)
+		assert.Equal(t, expected.offset, req.Offset)
+		assert.True(t, req.Scaled)
+	}
+
+	// Square sources only have one scaled slice worth taking.
+	sourceImage, err = filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	renderer = &recordingRenderer{}
+	err = ExtractFromLocalImage("64x64", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard, Steps: 3})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Center", renderer.reqs[0].Gravity)
+	assert.Equal(t, 1+len(unscaledGravities), len(renderer.reqs))
+}
+
+func TestExtractFromLocalImageRotated(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Too short for the slices as it is, but tall enough once rotated.
+	err = ExtractFromLocalImage("96x160", tempDir, sourceImage, Options{Renderer: &recordingRenderer{}, Log: ioutil.Discard})
+	assert.Equal(t, "Image (wide.jpg) is not tall enough to produce quality 96x160 output", err.Error())
+
+	renderer := &recordingRenderer{}
+	opts := Options{Renderer: renderer, Log: ioutil.Discard, Rotate: 90, Flip: FlipHorizontal}
+	err = ExtractFromLocalImage("96x160", tempDir, sourceImage, opts)
+	assert.NoError(t, err)
+
+	// Rotated, the source is tall, so scaled slices move from north to south.
+	assert.Equal(t, 3+len(unscaledGravities), len(renderer.reqs))
+	for i, gravity := range tallAspectRatioGravities {
+		req := renderer.reqs[i]
+		assert.Equal(t, path.Join(tempDir, "96x160", "wide_scaled_rot90_fliph_"+strings.ToLower(gravity)+".jpg"), req.OutputPath)
+		assert.Equal(t, gravity, req.Gravity)
+	}
+
+	for _, req := range renderer.reqs {
+		assert.Equal(t, 90, req.Rotate)
+		assert.Equal(t, FlipHorizontal, req.Flip)
+	}
+
+	unscaled := renderer.reqs[len(renderer.reqs)-1]
+	assert.Equal(t, path.Join(tempDir, "96x160", "wide_rot90_fliph_center.jpg"), unscaled.OutputPath)
+}
+
+func TestExtractFromLocalImageDuplicateTolerance(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Scaled to 65x32, so slices can only move one pixel.
+	sourceImage := path.Join(tempDir, "nearly.png")
+	writePng(t, sourceImage, image.NewRGBA(image.Rect(0, 0, 130, 64)))
+
+	renderer := &recordingRenderer{}
+	err = ExtractFromLocalImage("64x32", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard})
+	assert.NoError(t, err)
+	assert.Equal(t, 3+len(unscaledGravities), len(renderer.reqs))
+
+	renderer = &recordingRenderer{}
+	err = ExtractFromLocalImage("64x32", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard, DuplicateTolerance: 1})
+	assert.Equal(t, "Image (nearly.png) would produce duplicate slices in 64x32, skipped nearly_scaled_west.png, nearly_scaled_east.png", err.Error())
+	assert.Equal(t, 1+len(unscaledGravities), len(renderer.reqs))
+	assert.Equal(t, "Center", renderer.reqs[0].Gravity)
+}
+
+func TestExtractFromLocalImageUnscaledDuplicates(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Scaled slices don't need the source resized, so every unscaled slice
+	//   lands on a scaled one.
+	sourceImage := path.Join(tempDir, "exact.png")
+	writePng(t, sourceImage, image.NewRGBA(image.Rect(0, 0, 96, 32)))
+
+	renderer := &recordingRenderer{}
+	err = ExtractFromLocalImage("64x32", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard})
+	assert.Equal(t, "Image (exact.png) would produce duplicate slices in 64x32, skipped "+strings.Join([]string{
+		"exact_north.png",
+		"exact_northeast.png",
+		"exact_east.png",
+		"exact_southeast.png",
+		"exact_south.png",
+		"exact_southwest.png",
+		"exact_west.png",
+		"exact_northwest.png",
+		"exact_center.png",
+	}, ", "), err.Error())
+
+	assert.Equal(t, 3, len(renderer.reqs))
+	for _, req := range renderer.reqs {
+		assert.True(t, req.Scaled)
+	}
+
+	// Sharpening changes the scaled slices, so nothing is skipped.
+	renderer = &recordingRenderer{}
+	err = ExtractFromLocalImage("64x32", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard, Sharpen: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 3+len(unscaledGravities), len(renderer.reqs))
+
+	// As does resampling with a filter other than box.
+	renderer = &recordingRenderer{}
+	err = ExtractFromLocalImage("64x32", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard, Filter: FilterLanczos})
+	assert.NoError(t, err)
+	assert.Equal(t, 3+len(unscaledGravities), len(renderer.reqs))
+
+	renderer = &recordingRenderer{}
+	err = ExtractFromLocalImage("64x32", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard, Filter: FilterBox})
+	assert.Error(t, err)
+	assert.Equal(t, 3, len(renderer.reqs))
+}
+
+func TestExtractFromLocalImageZoom(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	err = ExtractFromLocalImage("64x64", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard, Zoom: []float64{1, 1.5, 2, 3}})
+	assert.Equal(t, "Image (wide.jpg) is not tall enough to produce quality 64x64 output at 3x zoom", err.Error())
+
+	// Zooming in 1x is just the regular scaled slices, and 3x would need the
+	//   source enlarged.
+	counts := map[float64]int{}
+	for _, req := range renderer.reqs {
+		if req.Scaled {
+			counts[req.Zoom]++
+		}
+	}
+	assert.Equal(t, map[float64]int{0: 3, 1.5: 9, 2: 9}, counts)
+
+	assert.Equal(t, path.Join(tempDir, "64x64", "wide_scaled_1.5x_north.jpg"), renderer.reqs[3].OutputPath)
+}
+
+func TestExtractFromLocalImageMaxUpscale(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	err = ExtractFromLocalImage("260x130", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard})
+	assert.Equal(t, "Image (wide.jpg) is not wide enough to produce quality 260x130 output", err.Error())
+	assert.Equal(t, 0, len(renderer.reqs))
+
+	// Only the scaled slices can be produced, and the 2x zoom would need
+	//   the source enlarged too much.
+	err = ExtractFromLocalImage("260x130", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard, MaxUpscale: 1.1, Zoom: []float64{1.05, 2}})
+	assert.Equal(t, strings.Join([]string{
+		"Image (wide.jpg) was upscaled 1.02x to produce wide_scaled_center.jpg in 260x130",
+		"Image (wide.jpg) was upscaled 1.07x to produce " + strings.Join([]string{
+			"wide_scaled_1.05x_north.jpg",
+			"wide_scaled_1.05x_northeast.jpg",
+			"wide_scaled_1.05x_east.jpg",
+			"wide_scaled_1.05x_southeast.jpg",
+			"wide_scaled_1.05x_south.jpg",
+			"wide_scaled_1.05x_southwest.jpg",
+			"wide_scaled_1.05x_west.jpg",
+			"wide_scaled_1.05x_northwest.jpg",
+			"wide_scaled_1.05x_center.jpg",
+		}, ", ") + " in 260x130",
+		"Image (wide.jpg) is not wide enough to produce quality 260x130 output at 2x zoom",
+		"Image (wide.jpg) is not wide enough to produce quality unscaled 260x130 output",
+	}, "\n"), err.Error())
+
+	assert.Equal(t, 10, len(renderer.reqs))
+	for _, req := range renderer.reqs {
+		assert.True(t, req.Scaled)
+	}
+}
+
+func TestPickFromImageZoom(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	is := &ImageSource{LocalPath: sourceImage}
+	err = PickFromImage("64x64", tempDir, is, false, "North", Options{Renderer: renderer, Log: ioutil.Discard, Zoom: []float64{1.5}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(renderer.reqs))
+	assert.Equal(t, path.Join(tempDir, "64x64", "wide_scaled_1.5x_north.jpg"), renderer.reqs[0].OutputPath)
+	assert.True(t, renderer.reqs[0].Scaled)
+	assert.Equal(t, 1.5, renderer.reqs[0].Zoom)
+}
+
+func TestExtractFromLocalImageContained(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "tall.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// The source is much smaller than the slices, but is contained anyway.
+	renderer := &recordingRenderer{}
+	err = ExtractFromLocalImage("1024x512", tempDir, sourceImage, Options{Renderer: renderer, Log: ioutil.Discard, Fit: FitContain, Fill: FillBlur, Zoom: []float64{1.5}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []RenderRequest{{
+		SourcePath: sourceImage,
+		OutputPath: path.Join(tempDir, "1024x512", "tall_contained_center.jpg"),
+		Gravity:    "Center",
+		Size:       image.Pt(1024, 512),
+		Scaled:     true,
+		Fit:        FitContain,
+		Fill:       FillBlur,
+	}}, renderer.reqs)
+}
+
+func TestPickFromImageContained(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	renderer := &recordingRenderer{}
+	is := &ImageSource{LocalPath: sourceImage}
+	err = PickFromImage("64x64", tempDir, is, false, "North", Options{Renderer: renderer, Log: ioutil.Discard, Fit: FitContain})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(renderer.reqs))
+	assert.Equal(t, path.Join(tempDir, "64x64", "wide_contained_north.jpg"), renderer.reqs[0].OutputPath)
+	assert.True(t, renderer.reqs[0].contained())
+
+	err = PickFromImage("64x64", tempDir, is, false, "0.5", Options{Renderer: renderer, Log: ioutil.Discard, Fit: FitContain})
+	assert.Equal(t, "Gravity (0.5) can't be used to place contained slices", err.Error())
+}
+
 func TestExtractFromLocalImageWideAspectRatio(t *testing.T) {
-	f := doImageMagick
+	f := runCommand
 	defer func() {
-		doImageMagick = f
+		runCommand = f
 	}()
 
 	cwd, err := os.Getwd()
@@ -211,24 +545,32 @@ func TestExtractFromLocalImageWideAspectRatio(t *testing.T) {
 	outputDir, _ := filepath.Abs(path.Join(tempDir, "64x64"))
 
 	expectedCalls := [][]string{
-		[]string{sourceImage, "-gravity", "West", "-scale", "64x64^", "-extent", "64x64", path.Join(outputDir, "wide_scaled_west.jpg")},
-		[]string{sourceImage, "-gravity", "Center", "-scale", "64x64^", "-extent", "64x64", path.Join(outputDir, "wide_scaled_center.jpg")},
-		[]string{sourceImage, "-gravity", "East", "-scale", "64x64^", "-extent", "64x64", path.Join(outputDir, "wide_scaled_east.jpg")},
-		[]string{sourceImage, "-gravity", "North", "-extent", "64x64", path.Join(outputDir, "wide_north.jpg")},
-		[]string{sourceImage, "-gravity", "NorthEast", "-extent", "64x64", path.Join(outputDir, "wide_northeast.jpg")},
-		[]string{sourceImage, "-gravity", "East", "-extent", "64x64", path.Join(outputDir, "wide_east.jpg")},
-		[]string{sourceImage, "-gravity", "SouthEast", "-extent", "64x64", path.Join(outputDir, "wide_southeast.jpg")},
-		[]string{sourceImage, "-gravity", "South", "-extent", "64x64", path.Join(outputDir, "wide_south.jpg")},
-		[]string{sourceImage, "-gravity", "SouthWest", "-extent", "64x64", path.Join(outputDir, "wide_southwest.jpg")},
-		[]string{sourceImage, "-gravity", "West", "-extent", "64x64", path.Join(outputDir, "wide_west.jpg")},
-		[]string{sourceImage, "-gravity", "NorthWest", "-extent", "64x64", path.Join(outputDir, "wide_northwest.jpg")},
-		[]string{sourceImage, "-gravity", "Center", "-extent", "64x64", path.Join(outputDir, "wide_center.jpg")},
+		concatArgs(
+			[]string{sourceImage, "-auto-orient"},
+			[]string{"(", "+clone", "-scale", "64x64^"},
+			batchCropArgs("West", "64x64", path.Join(outputDir, "wide_scaled_west.jpg")),
+			batchCropArgs("Center", "64x64", path.Join(outputDir, "wide_scaled_center.jpg")),
+			batchCropArgs("East", "64x64", path.Join(outputDir, "wide_scaled_east.jpg")),
+			[]string{"+delete", ")"},
+			batchCropArgs("North", "64x64", path.Join(outputDir, "wide_north.jpg")),
+			batchCropArgs("NorthEast", "64x64", path.Join(outputDir, "wide_northeast.jpg")),
+			batchCropArgs("East", "64x64", path.Join(outputDir, "wide_east.jpg")),
+			batchCropArgs("SouthEast", "64x64", path.Join(outputDir, "wide_southeast.jpg")),
+			batchCropArgs("South", "64x64", path.Join(outputDir, "wide_south.jpg")),
+			batchCropArgs("SouthWest", "64x64", path.Join(outputDir, "wide_southwest.jpg")),
+			batchCropArgs("West", "64x64", path.Join(outputDir, "wide_west.jpg")),
+			batchCropArgs("NorthWest", "64x64", path.Join(outputDir, "wide_northwest.jpg")),
+			batchCropArgs("Center", "64x64", path.Join(outputDir, "wide_center.jpg")),
+			[]string{"null:"},
+		),
 	}
 
-	doImageMagick = func(args ...string) (string, error) {
+	runCommand = func(name string, args ...string) (string, error) {
+		assert.Equal(t, "convert", name)
+
 		// Fail now, rather than assert. Assert will continue, and crash at [0]
 		if len(expectedCalls) == 0 {
-			fmt.Fprintln(os.Stderr, "doImageMagick called when not expected")
+			fmt.Fprintln(os.Stderr, "runCommand called when not expected")
 			t.FailNow()
 		}
 
@@ -237,16 +579,16 @@ func TestExtractFromLocalImageWideAspectRatio(t *testing.T) {
 		return "", nil
 	}
 
-	err = ExtractFromLocalImage("64x64", tempDir, sourceImage)
+	err = ExtractFromLocalImage("64x64", tempDir, sourceImage, imageMagickOptions)
 	assert.NoError(t, err)
 
 	assert.Equal(t, 0, len(expectedCalls))
 }
 
 func TestExtractFromLocalImageTallAspectRatio(t *testing.T) {
-	f := doImageMagick
+	f := runCommand
 	defer func() {
-		doImageMagick = f
+		runCommand = f
 	}()
 
 	cwd, err := os.Getwd()
@@ -263,24 +605,32 @@ func TestExtractFromLocalImageTallAspectRatio(t *testing.T) {
 	assert.NoError(t, err)
 
 	expectedCalls := [][]string{
-		[]string{sourceImage, "-gravity", "North", "-scale", "64x64^", "-extent", "64x64", path.Join(outputDir, "tall_scaled_north.jpg")},
-		[]string{sourceImage, "-gravity", "Center", "-scale", "64x64^", "-extent", "64x64", path.Join(outputDir, "tall_scaled_center.jpg")},
-		[]string{sourceImage, "-gravity", "South", "-scale", "64x64^", "-extent", "64x64", path.Join(outputDir, "tall_scaled_south.jpg")},
-		[]string{sourceImage, "-gravity", "North", "-extent", "64x64", path.Join(outputDir, "tall_north.jpg")},
-		[]string{sourceImage, "-gravity", "NorthEast", "-extent", "64x64", path.Join(outputDir, "tall_northeast.jpg")},
-		[]string{sourceImage, "-gravity", "East", "-extent", "64x64", path.Join(outputDir, "tall_east.jpg")},
-		[]string{sourceImage, "-gravity", "SouthEast", "-extent", "64x64", path.Join(outputDir, "tall_southeast.jpg")},
-		[]string{sourceImage, "-gravity", "South", "-extent", "64x64", path.Join(outputDir, "tall_south.jpg")},
-		[]string{sourceImage, "-gravity", "SouthWest", "-extent", "64x64", path.Join(outputDir, "tall_southwest.jpg")},
-		[]string{sourceImage, "-gravity", "West", "-extent", "64x64", path.Join(outputDir, "tall_west.jpg")},
-		[]string{sourceImage, "-gravity", "NorthWest", "-extent", "64x64", path.Join(outputDir, "tall_northwest.jpg")},
-		[]string{sourceImage, "-gravity", "Center", "-extent", "64x64", path.Join(outputDir, "tall_center.jpg")},
+		concatArgs(
+			[]string{sourceImage, "-auto-orient"},
+			[]string{"(", "+clone", "-scale", "64x64^"},
+			batchCropArgs("North", "64x64", path.Join(outputDir, "tall_scaled_north.jpg")),
+			batchCropArgs("Center", "64x64", path.Join(outputDir, "tall_scaled_center.jpg")),
+			batchCropArgs("South", "64x64", path.Join(outputDir, "tall_scaled_south.jpg")),
+			[]string{"+delete", ")"},
+			batchCropArgs("North", "64x64", path.Join(outputDir, "tall_north.jpg")),
+			batchCropArgs("NorthEast", "64x64", path.Join(outputDir, "tall_northeast.jpg")),
+			batchCropArgs("East", "64x64", path.Join(outputDir, "tall_east.jpg")),
+			batchCropArgs("SouthEast", "64x64", path.Join(outputDir, "tall_southeast.jpg")),
+			batchCropArgs("South", "64x64", path.Join(outputDir, "tall_south.jpg")),
+			batchCropArgs("SouthWest", "64x64", path.Join(outputDir, "tall_southwest.jpg")),
+			batchCropArgs("West", "64x64", path.Join(outputDir, "tall_west.jpg")),
+			batchCropArgs("NorthWest", "64x64", path.Join(outputDir, "tall_northwest.jpg")),
+			batchCropArgs("Center", "64x64", path.Join(outputDir, "tall_center.jpg")),
+			[]string{"null:"},
+		),
 	}
 
-	doImageMagick = func(args ...string) (string, error) {
+	runCommand = func(name string, args ...string) (string, error) {
+		assert.Equal(t, "convert", name)
+
 		// Fail now, rather than assert. Assert will continue, and crash at [0]
 		if len(expectedCalls) == 0 {
-			fmt.Fprintln(os.Stderr, "doImageMagick called when not expected")
+			fmt.Fprintln(os.Stderr, "runCommand called when not expected")
 			t.FailNow()
 		}
 
@@ -289,16 +639,16 @@ func TestExtractFromLocalImageTallAspectRatio(t *testing.T) {
 		return "", nil
 	}
 
-	err = ExtractFromLocalImage("64x64", tempDir, sourceImage)
+	err = ExtractFromLocalImage("64x64", tempDir, sourceImage, imageMagickOptions)
 	assert.NoError(t, err)
 
 	assert.Equal(t, 0, len(expectedCalls))
 }
 
 func TestExtractFromImageLocal(t *testing.T) {
-	f := doImageMagick
+	f := runCommand
 	defer func() {
-		doImageMagick = f
+		runCommand = f
 	}()
 
 	cwd, err := os.Getwd()
@@ -307,13 +657,68 @@ func TestExtractFromImageLocal(t *testing.T) {
 	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "tall.jpg"))
 	assert.NoError(t, err)
 
-	is, err := PrepareImageFromSource(sourceImage, "")
+	is, err := PrepareImageFromSource(sourceImage, "", DownloadOptions{})
 	assert.NoError(t, err)
 
 	tempDir, err := ioutil.TempDir("", "")
 	assert.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
-	err = ExtractFromImage("64x64", tempDir, is)
+	err = ExtractFromImage("64x64", tempDir, is, Options{})
 	assert.NoError(t, err)
 }
+
+func TestExtractGravitiesFromLocalImageNative(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	runCommand = func(name string, args ...string) (string, error) {
+		assert.Fail(t, "Imagemagick should not be called in this test")
+		return "", nil
+	}
+
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	err = ExtractGravitiesFromLocalImage(sourceImage, true, []string{"Center"}, "64x64", tempDir, Options{Renderer: &nativeRenderer{}})
+	assert.NoError(t, err)
+
+	dims, err := GetImageDimensions(path.Join(tempDir, "square_scaled_center.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(64, 64), dims)
+}
+
+func TestRenderRequestsSharedOutput(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	reqs := []RenderRequest{
+		{SourcePath: "a.png", OutputPath: path.Join(tempDir, "a_center.png")},
+		{SourcePath: "a.png", OutputPath: path.Join(tempDir, "a_north.png")},
+	}
+
+	// Another source with the same name is rendering one of the outputs.
+	unlock := lockOutputPaths(reqs[1:])
+
+	renderer := &recordingRenderer{}
+	done := make(chan error)
+	go func() {
+		done <- renderRequests(renderer, reqs)
+	}()
+
+	assert.NoError(t, ioutil.WriteFile(reqs[1].OutputPath, []byte{}, 0644))
+	unlock()
+
+	assert.NoError(t, <-done)
+	assert.Equal(t, reqs[:1], renderer.reqs)
+}
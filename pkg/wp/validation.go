@@ -4,13 +4,28 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"math"
 	"strconv"
+	"strings"
 )
 
 /*
-  Parse a string in the form <x>x<y> and return a Point specifying the extents
+  Parse a string in the form <x>x<y>, or the name of a preset, and return a
+  Point specifying the extents
+  Either can be followed by a scale factor, like 1440x900@2x, in which case
+  the extents are multiplied by it.
 */
 func ParseDimensionsString(str string) (image.Point, error) {
+	str, err := ResolveDimensions(str)
+	if err != nil {
+		return image.ZP, err
+	}
+
+	str, factor, err := splitScaleFactor(str)
+	if err != nil {
+		return image.ZP, err
+	}
+
 	dimensionsMatch := dimensionsRegexp.FindStringSubmatch(str)
 
 	if len(dimensionsMatch) == 0 {
@@ -27,5 +42,208 @@ func ParseDimensionsString(str string) (image.Point, error) {
 		return image.ZP, errors.New("Provided height is not a valid positive integer")
 	}
 
-	return image.Pt(width, height), nil
+	return image.Pt(
+		int(math.Max(1, math.Floor(float64(width)*factor+0.5))),
+		int(math.Max(1, math.Floor(float64(height)*factor+0.5))),
+	), nil
+}
+
+// Parse a comma separated list of monitors, each in the form <x>x<y>+<a>+<b>,
+//   where a and b are the offset of the monitor's top left corner, and can be
+//   negative. Presets can be used in place of <x>x<y>.
+// Returns the area each monitor covers.
+func ParseLayoutString(str string) ([]image.Rectangle, error) {
+	var monitors []image.Rectangle
+	for _, monitor := range strings.Split(str, ",") {
+		layoutMatch := layoutRegexp.FindStringSubmatch(monitor)
+		if len(layoutMatch) == 0 {
+			return nil, errors.New(fmt.Sprintf("Provided layout (%s) is not valid", str))
+		}
+
+		size, err := ParseDimensionsString(layoutMatch[1])
+		if err != nil {
+			return nil, err
+		}
+
+		x, err := strconv.Atoi(layoutMatch[2])
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Provided layout (%s) is not valid", str))
+		}
+
+		y, err := strconv.Atoi(layoutMatch[3])
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Provided layout (%s) is not valid", str))
+		}
+
+		offset := image.Pt(x, y)
+		monitors = append(monitors, image.Rectangle{offset, offset.Add(size)})
+	}
+
+	return monitors, nil
+}
+
+// Check that the provided filter name is one that can be used to scale.
+// The empty string is treated as box.
+func ValidateFilter(filter string) error {
+	if _, ok := filterKernels[filter]; ok || filter == "" || filter == FilterBox {
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf("Unknown filter (%s)", filter))
+}
+
+// Check that the provided format is one that slices can be written in.
+// The empty string keeps the source image's format.
+func ValidateFormat(format string) error {
+	if _, ok := formatExtensions[format]; ok || format == "" {
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf("Unknown format (%s)", format))
+}
+
+// Check that the renderer can write slices in the provided format.
+// Renderers that aren't limited to some formats can write all of them.
+func ValidateRendererFormat(renderer Renderer, format string) error {
+	if r, ok := renderer.(FormatRenderer); ok {
+		return r.CheckFormat(format)
+	}
+
+	return nil
+}
+
+// Check that the quality and compression levels are within range.
+// Zero is allowed for both, and leaves them up to the renderer.
+func ValidateQuality(quality int, compression int) error {
+	if quality < 0 || quality > 100 {
+		return errors.New("Provided quality must be between 1 and 100")
+	}
+
+	if compression < 0 || compression > 9 {
+		return errors.New("Provided compression level must be between 1 and 9")
+	}
+
+	return nil
+}
+
+// Parse a comma separated list of dimensions or presets, like 1080p,2560x1440.
+// Returns the distinct <x>x<y> dimensions listed, in the order they were
+//   first listed.
+func ParseDimensionsList(str string) ([]string, error) {
+	var dimensions []string
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(str, ",") {
+		resolved, err := ResolveDimensions(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := ParseDimensionsString(resolved); err != nil {
+			return nil, err
+		}
+
+		if !seen[resolved] {
+			seen[resolved] = true
+			dimensions = append(dimensions, resolved)
+		}
+	}
+
+	return dimensions, nil
+}
+
+// Parse a comma separated list of device scale factors, like 1,2,3.
+func ParseScaleFactors(str string) ([]float64, error) {
+	if str == "" {
+		return nil, nil
+	}
+
+	var factors []float64
+	for _, level := range strings.Split(str, ",") {
+		factor, err := strconv.ParseFloat(strings.TrimSpace(level), 64)
+		if err != nil || math.IsNaN(factor) || math.IsInf(factor, 0) || factor <= 0 {
+			return nil, errors.New(fmt.Sprintf("Provided scale factor (%s) is not valid", level))
+		}
+
+		factors = append(factors, factor)
+	}
+
+	return factors, nil
+}
+
+// Get the dimensions of every display a wallpaper of each of the dimensions
+//   is needed for, at each of the scale factors, like 1440x900@2x.
+// Dimensions that already have a scale factor are kept as they are.
+func ScaledDimensions(dimensions []string, factors []float64) []string {
+	if len(factors) == 0 {
+		return dimensions
+	}
+
+	var scaled []string
+	seen := map[string]bool{}
+	add := func(d string) {
+		if !seen[d] {
+			seen[d] = true
+			scaled = append(scaled, d)
+		}
+	}
+
+	for _, d := range dimensions {
+		if scaleFactorRegexp.MatchString(d) {
+			add(d)
+			continue
+		}
+
+		for _, factor := range factors {
+			if factor == 1 {
+				add(d)
+			} else {
+				add(d + "@" + zoomString(factor))
+			}
+		}
+	}
+
+	return scaled
+}
+
+// Parse a comma separated list of zoom levels, like 1.0,1.5,2.0.
+// Zooms less than 1 wouldn't cover the slice, so aren't allowed.
+func ParseZoomLevels(str string) ([]float64, error) {
+	if str == "" {
+		return nil, nil
+	}
+
+	var zooms []float64
+	for _, level := range strings.Split(str, ",") {
+		zoom, err := strconv.ParseFloat(strings.TrimSpace(level), 64)
+		if err != nil || math.IsNaN(zoom) || math.IsInf(zoom, 0) {
+			return nil, errors.New(fmt.Sprintf("Provided zoom level (%s) is not valid", level))
+		}
+
+		if zoom < 1 {
+			return nil, errors.New(fmt.Sprintf("Provided zoom level (%s) must be at least 1", level))
+		}
+
+		zooms = append(zooms, zoom)
+	}
+
+	return zooms, nil
+}
+
+// Check that the provided upscale tolerance doesn't ask for slices to be
+//   shrunk; 0 is accepted as not allowing any upscaling.
+func ValidateMaxUpscale(maxUpscale float64) error {
+	if maxUpscale != 0 && maxUpscale < 1 {
+		return errors.New("Provided maximum upscale must be at least 1")
+	}
+
+	return nil
+}
+
+// Check that the provided overlap percentage leaves tiles room to move.
+func ValidateOverlap(overlap float64) error {
+	if overlap < 0 || overlap >= 100 {
+		return errors.New("Provided overlap must be at least 0, and less than 100")
+	}
+
+	return nil
 }
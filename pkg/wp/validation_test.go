@@ -37,3 +37,139 @@ func TestParseDimensionsStringInvalidHeight(t *testing.T) {
 	assert.Equal(t, point, image.ZP)
 	assert.Equal(t, err.Error(), "Provided height is not a valid positive integer")
 }
+
+func TestValidateFilter(t *testing.T) {
+	for _, filter := range []string{"", "box", "triangle", "catmull-rom", "mitchell", "lanczos"} {
+		assert.NoError(t, ValidateFilter(filter))
+	}
+
+	assert.Equal(t, "Unknown filter (gaussian)", ValidateFilter("gaussian").Error())
+}
+
+func TestValidateFormat(t *testing.T) {
+	for _, format := range []string{"", "png", "jpeg", "webp", "avif"} {
+		assert.NoError(t, ValidateFormat(format))
+	}
+
+	assert.Equal(t, "Unknown format (tiff)", ValidateFormat("tiff").Error())
+}
+
+func TestValidateRendererFormat(t *testing.T) {
+	for _, format := range []string{"", "png", "jpeg"} {
+		assert.NoError(t, ValidateRendererFormat(&nativeRenderer{}, format))
+	}
+
+	assert.Equal(t, "Native renderer can't write slices in format (webp); install ImageMagick, GraphicsMagick, or libvips to use it", ValidateRendererFormat(&nativeRenderer{}, "webp").Error())
+	assert.NoError(t, ValidateRendererFormat(&vipsRenderer{}, "avif"))
+}
+
+func TestValidateQuality(t *testing.T) {
+	assert.NoError(t, ValidateQuality(0, 0))
+	assert.NoError(t, ValidateQuality(100, 9))
+	assert.Equal(t, "Provided quality must be between 1 and 100", ValidateQuality(101, 0).Error())
+	assert.Equal(t, "Provided compression level must be between 1 and 9", ValidateQuality(50, 10).Error())
+}
+
+func TestParseZoomLevels(t *testing.T) {
+	zooms, err := ParseZoomLevels("1.0,1.5, 2")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1, 1.5, 2}, zooms)
+
+	zooms, err = ParseZoomLevels("")
+	assert.NoError(t, err)
+	assert.Nil(t, zooms)
+
+	_, err = ParseZoomLevels("1.5,abc")
+	assert.Equal(t, "Provided zoom level (abc) is not valid", err.Error())
+
+	_, err = ParseZoomLevels("0.5")
+	assert.Equal(t, "Provided zoom level (0.5) must be at least 1", err.Error())
+}
+
+func TestParseLayoutString(t *testing.T) {
+	monitors, err := ParseLayoutString("2560x1440+0+0,1080x1920+2560-240")
+	assert.NoError(t, err)
+	assert.Equal(t, []image.Rectangle{
+		image.Rect(0, 0, 2560, 1440),
+		image.Rect(2560, -240, 3640, 1680),
+	}, monitors)
+
+	_, err = ParseLayoutString("2560x1440")
+	assert.Equal(t, "Provided layout (2560x1440) is not valid", err.Error())
+
+	_, err = ParseLayoutString("2560x1440+0+0,")
+	assert.Equal(t, "Provided layout (2560x1440+0+0,) is not valid", err.Error())
+
+	_, err = ParseLayoutString("0x1440+0+0")
+	assert.Equal(t, "Provided width is not a valid positive integer", err.Error())
+}
+
+func TestValidateOverlap(t *testing.T) {
+	assert.NoError(t, ValidateOverlap(0))
+	assert.NoError(t, ValidateOverlap(99.5))
+	assert.Equal(t, "Provided overlap must be at least 0, and less than 100", ValidateOverlap(100).Error())
+	assert.Equal(t, "Provided overlap must be at least 0, and less than 100", ValidateOverlap(-1).Error())
+}
+
+func TestValidateMaxUpscale(t *testing.T) {
+	assert.NoError(t, ValidateMaxUpscale(0))
+	assert.NoError(t, ValidateMaxUpscale(1))
+	assert.NoError(t, ValidateMaxUpscale(1.1))
+	assert.Equal(t, "Provided maximum upscale must be at least 1", ValidateMaxUpscale(0.9).Error())
+}
+
+func TestParseDimensionsList(t *testing.T) {
+	defer mockConfigPath("/not/a/config.json")()
+
+	dimensions, err := ParseDimensionsList("1080p, 2560x1440,4k,1920x1080")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1920x1080", "2560x1440", "3840x2160"}, dimensions)
+
+	_, err = ParseDimensionsList("1080p,")
+	assert.Equal(t, "Provided dimension string () is not valid", err.Error())
+
+	_, err = ParseDimensionsList("1080p,0x10")
+	assert.Equal(t, "Provided width is not a valid positive integer", err.Error())
+}
+
+func TestParseDimensionsStringScaleFactor(t *testing.T) {
+	defer mockConfigPath("/not/a/config.json")()
+
+	for str, expected := range map[string]image.Point{
+		"1440x900@2x":   image.Pt(2880, 1800),
+		"1440x900@1x":   image.Pt(1440, 900),
+		"1440x900@1.5x": image.Pt(2160, 1350),
+		"1080p@3x":      image.Pt(5760, 3240),
+	} {
+		size, err := ParseDimensionsString(str)
+		assert.NoError(t, err, str)
+		assert.Equal(t, expected, size, str)
+	}
+
+	_, err := ParseDimensionsString("1440x900@0x")
+	assert.Equal(t, "Provided scale factor (0) is not valid", err.Error())
+
+	_, err = ParseDimensionsString("1440x900@1.2.3x")
+	assert.Equal(t, "Provided scale factor (1.2.3) is not valid", err.Error())
+}
+
+func TestParseScaleFactors(t *testing.T) {
+	factors, err := ParseScaleFactors("")
+	assert.NoError(t, err)
+	assert.Nil(t, factors)
+
+	factors, err = ParseScaleFactors("1, 2,2.625")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1, 2, 2.625}, factors)
+
+	_, err = ParseScaleFactors("1,-2")
+	assert.Equal(t, "Provided scale factor (-2) is not valid", err.Error())
+}
+
+func TestScaledDimensions(t *testing.T) {
+	assert.Equal(t, []string{"1440x900"}, ScaledDimensions([]string{"1440x900"}, nil))
+	assert.Equal(t,
+		[]string{"1440x900", "1440x900@2x", "2560x1440", "2560x1440@2x", "390x844@3x"},
+		ScaledDimensions([]string{"1440x900", "2560x1440", "390x844@3x"}, []float64{1, 2, 1}),
+	)
+}
@@ -0,0 +1,338 @@
+package wp
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strconv"
+)
+
+// Renders slices using the libvips command line tool.
+// vips has no notion of gravity, so the geometry of each slice is worked out
+//   here, and vips is only asked to scale and cut out exact regions.
+// Every slice of a source is cut from the same transformed, and scaled,
+//   intermediates, so each source is only prepared once.
+type vipsRenderer struct{}
+
+// The vips kernel used for each filter other than box, which vips has no
+//   kernel for, so is done with shrink instead.
+var vipsKernels map[string]string = map[string]string{
+	FilterTriangle:   "linear",
+	FilterCatmullRom: "cubic",
+	FilterMitchell:   "mitchell",
+	FilterLanczos:    "lanczos3",
+}
+
+// The vips direction for each flip.
+var vipsFlipDirections map[string]string = map[string]string{
+	FlipHorizontal: "horizontal",
+	FlipVertical:   "vertical",
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (r *vipsRenderer) vips(args ...string) error {
+	output, err := runCommand("vips", args...)
+	if err != nil {
+		return MultiErrorFromErrors([]error{errors.New(output), err})
+	}
+
+	return nil
+}
+
+func (r *vipsRenderer) Render(req RenderRequest) error {
+	return r.RenderBatch([]RenderRequest{req})
+}
+
+// Render every slice of a source, orienting and transforming it only once,
+//   and scaling it once for each group of slices that share a scale.
+func (r *vipsRenderer) RenderBatch(reqs []RenderRequest) error {
+	sourceSize, err := reqs[0].sourceSize()
+	if err != nil {
+		return err
+	}
+
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	input, err := r.transform(reqs[0], tempDir)
+	if err != nil {
+		return err
+	}
+
+	// Intermediates are only needed until each slice, or group of slices, is
+	//   written, so every one of them can share the directory.
+	var errs []error
+	contained, reqs := splitContained(reqs)
+	for _, req := range contained {
+		errs = append(errs, r.contain(req, input, sourceSize, tempDir))
+	}
+
+	unscaled, scaled := partitionRequests(reqs)
+	for _, group := range scaled {
+		scaledSize := group[0].frame(sourceSize)
+		scaledInput, err := r.scale(group[0], input, sourceSize, scaledSize, tempDir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, req := range group {
+			errs = append(errs, r.cut(req, scaledInput, scaledSize, tempDir))
+		}
+	}
+
+	for _, req := range unscaled {
+		errs = append(errs, r.cut(req, input, sourceSize, tempDir))
+	}
+
+	if err := MultiErrorFromErrors(errs); err.Exists() {
+		return err
+	}
+
+	return nil
+}
+
+// Orient the request's source upright, and rotate and flip it, writing any
+//   intermediates into the provided directory.
+// Returns the path of the transformed source, which is the source itself if
+//   it didn't need to be changed.
+func (r *vipsRenderer) transform(req RenderRequest, dir string) (string, error) {
+	// Slices are positioned against the size of the upright, transformed
+	//   image, so rotate the source to match before doing anything else.
+	input := req.SourcePath
+	orientation, err := readOrientation(req.SourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	if orientation != orientationNormal {
+		input = path.Join(dir, "oriented.v")
+		if err := r.vips("autorot", req.SourcePath, input); err != nil {
+			return "", err
+		}
+	}
+
+	if req.Rotate != 0 {
+		rotatedPath := path.Join(dir, "rotated.v")
+		if err := r.vips("rot", input, rotatedPath, fmt.Sprintf("d%d", req.Rotate)); err != nil {
+			return "", err
+		}
+		input = rotatedPath
+	}
+
+	if direction, ok := vipsFlipDirections[req.Flip]; ok {
+		flippedPath := path.Join(dir, "flipped.v")
+		if err := r.vips("flip", input, flippedPath, direction); err != nil {
+			return "", err
+		}
+		input = flippedPath
+	}
+
+	return input, nil
+}
+
+// Cut the request's slice out of the input, which is of the given size.
+func (r *vipsRenderer) cut(req RenderRequest, input string, sourceSize image.Point, dir string) error {
+	offset, err := req.offset(sourceSize)
+	if err != nil {
+		return err
+	}
+
+	outputPath := r.outputPath(req)
+
+	region := image.Rectangle{offset, offset.Add(req.Size)}
+	visible := region.Intersect(image.Rect(0, 0, sourceSize.X, sourceSize.Y))
+	if visible == region {
+		return r.extractArea(input, outputPath, region)
+	}
+
+	// The slice runs off the edge of the source, so cut out what's there, and
+	//   place it within a white canvas, like ImageMagick's -extent does.
+	visiblePath := path.Join(dir, "visible.v")
+	if err := r.extractArea(input, visiblePath, visible); err != nil {
+		return err
+	}
+
+	position := visible.Min.Sub(offset)
+	return r.vips(
+		"embed", visiblePath, outputPath,
+		strconv.Itoa(position.X), strconv.Itoa(position.Y),
+		strconv.Itoa(req.Size.X), strconv.Itoa(req.Size.Y),
+		"--extend", "white",
+	)
+}
+
+// Scale the input to fit within the slice, and place it on the slice's fill.
+func (r *vipsRenderer) contain(req RenderRequest, input string, sourceSize image.Point, dir string) error {
+	fittedSize := scaleToFit(sourceSize, req.Size)
+	offset, err := req.containOffset(fittedSize)
+	if err != nil {
+		return err
+	}
+
+	fitted, err := r.scale(req, input, sourceSize, fittedSize, dir)
+	if err != nil {
+		return err
+	}
+
+	outputPath := r.outputPath(req)
+	embed := []string{
+		"embed", fitted, outputPath,
+		strconv.Itoa(offset.X), strconv.Itoa(offset.Y),
+		strconv.Itoa(req.Size.X), strconv.Itoa(req.Size.Y),
+	}
+
+	switch req.Fill {
+	case FillEdge:
+		return r.vips(append(embed, "--extend", "copy")...)
+	case FillBlur:
+		background, err := r.blurredBackground(req, input, sourceSize, dir)
+		if err != nil {
+			return err
+		}
+
+		return r.vips(
+			"insert", background, fitted, outputPath,
+			strconv.Itoa(offset.X), strconv.Itoa(offset.Y),
+		)
+	}
+
+	c := req.fillColor()
+	return r.vips(append(embed, "--extend", "background", "--background", fmt.Sprintf("%d %d %d", c.R, c.G, c.B))...)
+}
+
+// Produce a blurred and darkened copy of the input that covers the slice.
+// Returns the path of the background.
+func (r *vipsRenderer) blurredBackground(req RenderRequest, input string, sourceSize image.Point, dir string) (string, error) {
+	coverSize := scaleToFill(sourceSize, req.Size)
+	coverPath := path.Join(dir, "cover.v")
+	err := r.vips(
+		"thumbnail", input, coverPath, strconv.Itoa(coverSize.X),
+		"--height", strconv.Itoa(coverSize.Y),
+		"--size", "force",
+	)
+	if err != nil {
+		return "", err
+	}
+
+	offset, _ := gravityOffset("Center", coverSize, req.Size)
+	croppedPath := path.Join(dir, "cropped.v")
+	if err := r.extractArea(coverPath, croppedPath, image.Rectangle{offset, offset.Add(req.Size)}); err != nil {
+		return "", err
+	}
+
+	blurredPath := path.Join(dir, "blurred.v")
+	if err := r.vips("gaussblur", croppedPath, blurredPath, formatFloat(fillBlurSigma)); err != nil {
+		return "", err
+	}
+
+	backgroundPath := path.Join(dir, "background.v")
+	err = r.vips("linear", blurredPath, backgroundPath, formatFloat(fillBlurDarken), "0", "--uchar")
+	return backgroundPath, err
+}
+
+// Get the path vips should write the slice to, with any options that
+//   control how it's encoded.
+func (r *vipsRenderer) outputPath(req RenderRequest) string {
+	if formatOfPath(req.OutputPath) == FormatPNG {
+		if req.Compression > 0 {
+			return fmt.Sprintf("%s[compression=%d]", req.OutputPath, req.Compression)
+		}
+	} else if req.Quality > 0 {
+		return fmt.Sprintf("%s[Q=%d]", req.OutputPath, req.Quality)
+	}
+
+	return req.OutputPath
+}
+
+// Scale the input to exactly the given size, writing the result into the
+//   provided directory.
+// Returns the path of the scaled image.
+func (r *vipsRenderer) scale(req RenderRequest, input string, sourceSize image.Point, scaledSize image.Point, dir string) (string, error) {
+	scaledPath := path.Join(dir, "scaled.v")
+
+	var err error
+	if kernel, ok := vipsKernels[req.Filter]; ok {
+		err = r.vips(
+			"resize", input, scaledPath,
+			formatFloat(float64(scaledSize.X)/float64(sourceSize.X)),
+			"--vscale", formatFloat(float64(scaledSize.Y)/float64(sourceSize.Y)),
+			"--kernel", kernel,
+		)
+	} else {
+		err = r.boxScale(input, scaledPath, sourceSize, scaledSize, dir)
+	}
+
+	if err != nil || req.Sharpen <= 0 {
+		return scaledPath, err
+	}
+
+	sharpenedPath := path.Join(dir, "sharpened.v")
+	err = r.vips(
+		"sharpen", scaledPath, sharpenedPath,
+		"--sigma", formatFloat(sharpenSigma),
+		"--m1", formatFloat(req.Sharpen),
+		"--m2", formatFloat(req.Sharpen),
+	)
+	return sharpenedPath, err
+}
+
+// Scale the input to exactly the given size by averaging together the pixels
+//   each output pixel covers, like box does for the other renderers.
+// vips' shrink averages whole blocks of pixels, which is exactly that when
+//   the input is a whole multiple of the size; whatever is left over is
+//   scaled with vips' linear kernel, the closest it has to an area average.
+func (r *vipsRenderer) boxScale(input string, output string, sourceSize image.Point, scaledSize image.Point, dir string) error {
+	shrink := image.Pt(maxInt(sourceSize.X/scaledSize.X, 1), maxInt(sourceSize.Y/scaledSize.Y, 1))
+	if shrink == image.Pt(1, 1) {
+		return r.resizeLinear(input, output, sourceSize, scaledSize)
+	}
+
+	// vips rounds the size of shrunk images to the nearest pixel.
+	shrunkSize := image.Pt(
+		int(math.Floor(float64(sourceSize.X)/float64(shrink.X)+0.5)),
+		int(math.Floor(float64(sourceSize.Y)/float64(shrink.Y)+0.5)),
+	)
+
+	shrunkPath := output
+	if shrunkSize != scaledSize {
+		shrunkPath = path.Join(dir, "shrunk.v")
+	}
+
+	if err := r.vips("shrink", input, shrunkPath, strconv.Itoa(shrink.X), strconv.Itoa(shrink.Y)); err != nil {
+		return err
+	}
+
+	if shrunkSize == scaledSize {
+		return nil
+	}
+
+	return r.resizeLinear(shrunkPath, output, shrunkSize, scaledSize)
+}
+
+func (r *vipsRenderer) resizeLinear(input string, output string, sourceSize image.Point, scaledSize image.Point) error {
+	return r.vips(
+		"resize", input, output,
+		formatFloat(float64(scaledSize.X)/float64(sourceSize.X)),
+		"--vscale", formatFloat(float64(scaledSize.Y)/float64(sourceSize.Y)),
+		"--kernel", vipsKernels[FilterTriangle],
+	)
+}
+
+func (r *vipsRenderer) extractArea(input string, output string, area image.Rectangle) error {
+	return r.vips(
+		"extract_area", input, output,
+		strconv.Itoa(area.Min.X), strconv.Itoa(area.Min.Y),
+		strconv.Itoa(area.Dx()), strconv.Itoa(area.Dy()),
+	)
+}
@@ -0,0 +1,359 @@
+package wp
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVipsRendererScaled(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "", nil
+	}
+
+	err = newRenderer(RendererVips).Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: "out.jpg",
+		Gravity:    "East",
+		Size:       image.Pt(64, 64),
+		Scaled:     true,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(calls))
+	scaledPath := calls[0][3]
+	assert.Equal(t, []string{"vips", "shrink", sourceImage, scaledPath, "2", "2"}, calls[0])
+	assert.Equal(t, []string{"vips", "extract_area", scaledPath, "out.jpg", "64", "0", "64", "64"}, calls[1])
+}
+
+func TestVipsRendererScaledBox(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "", nil
+	}
+
+	// The 256x128 source is shrunk by whole blocks of pixels as far as it
+	//   can be, and only what's left over is resampled.
+	err = newRenderer(RendererVips).Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: "out.jpg",
+		Gravity:    "Center",
+		Size:       image.Pt(48, 48),
+		Scaled:     true,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(calls))
+	shrunkPath := calls[0][3]
+	scaledPath := calls[1][3]
+	assert.Equal(t, []string{"vips", "shrink", sourceImage, shrunkPath, "2", "2"}, calls[0])
+	assert.Equal(t, []string{"vips", "resize", shrunkPath, scaledPath, "0.75", "--vscale", "0.75", "--kernel", "linear"}, calls[1])
+	assert.Equal(t, []string{"vips", "extract_area", scaledPath, "out.jpg", "24", "0", "48", "48"}, calls[2])
+}
+
+func TestVipsRendererPadsSmallSource(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "tall.jpg"))
+	assert.NoError(t, err)
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "", nil
+	}
+
+	err = newRenderer(RendererVips).Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: "out.jpg",
+		Gravity:    "North",
+		Size:       image.Pt(256, 64),
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(calls))
+	visiblePath := calls[0][3]
+	assert.Equal(t, []string{"vips", "extract_area", sourceImage, visiblePath, "0", "0", "128", "64"}, calls[0])
+	assert.Equal(t, []string{"vips", "embed", visiblePath, "out.jpg", "64", "0", "256", "64", "--extend", "white"}, calls[1])
+}
+
+func TestVipsRendererOriented(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	sourceImage := path.Join(tempDir, "rotated.jpg")
+	writeOrientedJpeg(t, sourceImage, image.Pt(64, 32), orientationRotate90)
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "", nil
+	}
+
+	err = newRenderer(RendererVips).Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: "out.jpg",
+		Gravity:    "South",
+		Size:       image.Pt(32, 32),
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(calls))
+	orientedPath := calls[0][3]
+	assert.Equal(t, []string{"vips", "autorot", sourceImage, orientedPath}, calls[0])
+	assert.Equal(t, []string{"vips", "extract_area", orientedPath, "out.jpg", "0", "32", "32", "32"}, calls[1])
+}
+
+func TestVipsRendererTransformed(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "", nil
+	}
+
+	// Rotated, the 256x128 source is tall, so South is at the bottom of it.
+	err = newRenderer(RendererVips).Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: "out.jpg",
+		Gravity:    "South",
+		Size:       image.Pt(128, 128),
+		Rotate:     90,
+		Flip:       FlipVertical,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(calls))
+	rotatedPath := calls[0][3]
+	flippedPath := calls[1][3]
+	assert.Equal(t, []string{"vips", "rot", sourceImage, rotatedPath, "d90"}, calls[0])
+	assert.Equal(t, []string{"vips", "flip", rotatedPath, flippedPath, "vertical"}, calls[1])
+	assert.Equal(t, []string{"vips", "extract_area", flippedPath, "out.jpg", "0", "128", "128", "128"}, calls[2])
+}
+
+func TestVipsRendererBatch(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "wide.jpg"))
+	assert.NoError(t, err)
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "", nil
+	}
+
+	// The source is only rotated once, and scaled once for both of the
+	//   scaled slices.
+	err = (&vipsRenderer{}).RenderBatch([]RenderRequest{
+		{SourcePath: sourceImage, OutputPath: "north.jpg", Gravity: "North", Size: image.Pt(64, 64), Scaled: true, Rotate: 90},
+		{SourcePath: sourceImage, OutputPath: "center.jpg", Gravity: "Center", Size: image.Pt(64, 64), Rotate: 90},
+		{SourcePath: sourceImage, OutputPath: "south.jpg", Gravity: "South", Size: image.Pt(64, 64), Scaled: true, Rotate: 90},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 5, len(calls))
+	rotatedPath := calls[0][3]
+	scaledPath := calls[1][3]
+	assert.Equal(t, []string{"vips", "rot", sourceImage, rotatedPath, "d90"}, calls[0])
+	assert.Equal(t, []string{"vips", "shrink", rotatedPath, scaledPath, "2", "2"}, calls[1])
+	assert.Equal(t, []string{"vips", "extract_area", scaledPath, "north.jpg", "0", "0", "64", "64"}, calls[2])
+	assert.Equal(t, []string{"vips", "extract_area", scaledPath, "south.jpg", "0", "64", "64", "64"}, calls[3])
+	assert.Equal(t, []string{"vips", "extract_area", rotatedPath, "center.jpg", "32", "96", "64", "64"}, calls[4])
+}
+
+func TestVipsRendererFailure(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "square.jpg"))
+	assert.NoError(t, err)
+
+	runCommand = func(name string, args ...string) (string, error) {
+		return "vips: unable to write", fmt.Errorf("exit status 1")
+	}
+
+	err = newRenderer(RendererVips).Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: "out.jpg",
+		Gravity:    "Center",
+		Size:       image.Pt(64, 64),
+	})
+	assert.Equal(t, "vips: unable to write\nexit status 1", err.Error())
+}
+
+func TestVipsRendererFilterAndSharpen(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "tall.jpg"))
+	assert.NoError(t, err)
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "", nil
+	}
+
+	err = newRenderer(RendererVips).Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: "out.jpg",
+		Gravity:    "South",
+		Size:       image.Pt(64, 64),
+		Scaled:     true,
+		Filter:     FilterCatmullRom,
+		Sharpen:    1.5,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(calls))
+	scaledPath := calls[0][3]
+	sharpenedPath := calls[1][3]
+	assert.Equal(t, []string{"vips", "resize", sourceImage, scaledPath, "0.5", "--vscale", "0.5", "--kernel", "cubic"}, calls[0])
+	assert.Equal(t, []string{"vips", "sharpen", scaledPath, sharpenedPath, "--sigma", "1", "--m1", "1.5", "--m2", "1.5"}, calls[1])
+	assert.Equal(t, []string{"vips", "extract_area", sharpenedPath, "out.jpg", "0", "64", "64", "64"}, calls[2])
+}
+
+func TestVipsRendererOutputPath(t *testing.T) {
+	r := &vipsRenderer{}
+
+	assert.Equal(t, "out.jpg", r.outputPath(RenderRequest{OutputPath: "out.jpg"}))
+	assert.Equal(t, "out.jpg[Q=75]", r.outputPath(RenderRequest{OutputPath: "out.jpg", Quality: 75, Compression: 4}))
+	assert.Equal(t, "out.png[compression=4]", r.outputPath(RenderRequest{OutputPath: "out.png", Quality: 75, Compression: 4}))
+	assert.Equal(t, "out.avif[Q=50]", r.outputPath(RenderRequest{OutputPath: "out.avif", Quality: 50}))
+}
+
+func TestVipsRendererContained(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "tall.jpg"))
+	assert.NoError(t, err)
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "", nil
+	}
+
+	req := RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: "out.jpg",
+		Gravity:    "Center",
+		Size:       image.Pt(256, 64),
+		Scaled:     true,
+		Fit:        FitContain,
+	}
+
+	assert.NoError(t, newRenderer(RendererVips).Render(req))
+	assert.Equal(t, 2, len(calls))
+	fittedPath := calls[0][3]
+	assert.Equal(t, []string{"vips", "shrink", sourceImage, fittedPath, "4", "4"}, calls[0])
+	assert.Equal(t, []string{"vips", "embed", fittedPath, "out.jpg", "112", "0", "256", "64", "--extend", "background", "--background", "0 0 0"}, calls[1])
+
+	calls = nil
+	req.Fill = FillEdge
+	assert.NoError(t, newRenderer(RendererVips).Render(req))
+	assert.Equal(t, 2, len(calls))
+	assert.Equal(t, []string{"vips", "embed", calls[0][3], "out.jpg", "112", "0", "256", "64", "--extend", "copy"}, calls[1])
+}
+
+func TestVipsRendererContainedBlur(t *testing.T) {
+	f := runCommand
+	defer func() {
+		runCommand = f
+	}()
+
+	cwd, _ := os.Getwd()
+	sourceImage, err := filepath.Abs(path.Join(cwd, "..", "..", "test_images", "tall.jpg"))
+	assert.NoError(t, err)
+
+	var calls [][]string
+	runCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "", nil
+	}
+
+	err = newRenderer(RendererVips).Render(RenderRequest{
+		SourcePath: sourceImage,
+		OutputPath: "out.jpg",
+		Gravity:    "West",
+		Size:       image.Pt(256, 64),
+		Scaled:     true,
+		Fit:        FitContain,
+		Fill:       FillBlur,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 6, len(calls))
+	fittedPath := calls[0][3]
+	coverPath := calls[1][3]
+	croppedPath := calls[2][3]
+	blurredPath := calls[3][3]
+	backgroundPath := calls[4][3]
+	assert.Equal(t, []string{"vips", "thumbnail", sourceImage, coverPath, "256", "--height", "512", "--size", "force"}, calls[1])
+	assert.Equal(t, []string{"vips", "extract_area", coverPath, croppedPath, "0", "224", "256", "64"}, calls[2])
+	assert.Equal(t, []string{"vips", "gaussblur", croppedPath, blurredPath, "20"}, calls[3])
+	assert.Equal(t, []string{"vips", "linear", blurredPath, backgroundPath, "0.6", "0", "--uchar"}, calls[4])
+	assert.Equal(t, []string{"vips", "insert", backgroundPath, fittedPath, "out.jpg", "0", "0"}, calls[5])
+}